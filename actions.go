@@ -2,43 +2,98 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
+	"log/slog"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
-// commentStyle represents comment syntax for a language
-type commentStyle struct {
-	prefix string
-	suffix string // empty if single-line comment
-}
-
-func textDocumentCodeAction(context *glsp.Context, params *protocol.CodeActionParams) (any, error) {
+func (s *Server) textDocumentCodeAction(context *glsp.Context, params *protocol.CodeActionParams) (any, error) {
 	uri := params.TextDocument.URI
 
 	var actions []protocol.CodeAction
 
 	// Check each diagnostic in the range
 	for _, diag := range params.Context.Diagnostics {
-		if diag.Source != nil && *diag.Source == "gitleaks" {
-			// Get document content to determine indentation
-			doc, ok := globalServer.documents.Get(uri)
-			if !ok {
-				continue
-			}
+		if diag.Source == nil || *diag.Source != "gitleaks" {
+			continue
+		}
+
+		// Resolve the finding behind the diagnostic; stale diagnostics
+		// from an older scan no longer resolve and get no actions
+		finding, ok := s.findFinding(uri, findingIDFromDiagnostic(diag))
+		if !ok {
+			slog.Debug("no finding for diagnostic", "uri", uri, "range", diag.Range)
+			continue
+		}
+
+		// Get document content to determine where the line ends
+		content, ok := s.documentContent(uri)
+		if !ok {
+			continue
+		}
+
+		// Add action to ignore this finding, unless the file's language
+		// cannot take a comment after the secret
+		style, ok := getCommentSyntax(s.documentLanguage(uri), uriToPath(uri))
+		if ok && inlineCommentSafe(content, diag.Range.Start.Line, style) {
+			actions = append(actions, createIgnoreAction(uri, diag, content, style))
+		}
 
-			// Add action to ignore this finding
-			actions = append(actions, createIgnoreAction(uri, diag, doc.Content))
+		// Add action to record the finding in the .gitleaksignore of its folder
+		folder := s.folderFor(uri)
+		if action, ok := s.createIgnoreFileAction(folder.rootPath(), diag, finding); ok {
+			actions = append(actions, action)
+		}
+
+		// Add actions to disable the rule in the config
+		actions = append(actions, s.createDisableRuleActions(folder, diag, finding)...)
+
+		// Add action to move the secret to an environment variable
+		rule := folder.scannerFor(finding.File).config.Rules[finding.RuleID]
+		if action, ok := s.createExtractEnvAction(uri, folder.rootPath(), content, diag, finding, rule); ok {
+			actions = append(actions, action)
 		}
 	}
 
+	// Add actions to ignore many findings at once
+	actions = append(actions, s.bulkIgnoreActions(uri, params.Context.Diagnostics, params.Context.Only)...)
+
+	// Keep the kinds the client asked for, such as source.fixAll on save
+	actions = slices.DeleteFunc(actions, func(action protocol.CodeAction) bool {
+		return !codeActionKindRequested(params.Context.Only, *action.Kind)
+	})
+
 	return actions, nil
 }
 
+// documentContent returns the text of an open document, or reads it from
+// disk for files only known from a workspace scan
+func (s *Server) documentContent(uri protocol.DocumentUri) (string, bool) {
+	if doc, ok := s.documents.Get(uri); ok {
+		return doc.Content, true
+	}
+
+	content, err := os.ReadFile(uriToPath(uri))
+	if err != nil {
+		slog.Debug("failed to read document", "uri", uri, "error", err)
+		return "", false
+	}
+	return string(content), true
+}
+
+// documentLanguage returns the languageId an open document was opened
+// with, or "" if it is not open
+func (s *Server) documentLanguage(uri protocol.DocumentUri) string {
+	doc, _ := s.documents.Get(uri)
+	return doc.LanguageID
+}
+
 // createIgnoreAction creates a code action to add gitleaks:allow comment
-func createIgnoreAction(uri protocol.DocumentUri, diag protocol.Diagnostic, content string) protocol.CodeAction {
+func createIgnoreAction(uri protocol.DocumentUri, diag protocol.Diagnostic, content string, style commentStyle) protocol.CodeAction {
 	// Calculate the line of the diagnostic
 	line := diag.Range.Start.Line
 
@@ -49,9 +104,6 @@ func createIgnoreAction(uri protocol.DocumentUri, diag protocol.Diagnostic, cont
 		lineContent = lines[line]
 	}
 
-	// Get comment syntax for the file type
-	style := getCommentSyntax(uriToPath(uri))
-
 	// Create the comment to append
 	var comment string
 	if style.suffix == "" {
@@ -88,45 +140,61 @@ func createIgnoreAction(uri protocol.DocumentUri, diag protocol.Diagnostic, cont
 	}
 }
 
-// getCommentSyntax returns the appropriate comment syntax for a file
-func getCommentSyntax(filename string) commentStyle {
-	// Extract extension
-	ext := strings.ToLower(filepath.Ext(filename))
-
-	// Map extensions to comment styles
-	switch ext {
-	// C-style comments: //
-	case ".go", ".rs", ".java", ".js", ".ts", ".jsx", ".tsx", ".c", ".cpp", ".cc", ".h", ".hpp",
-		".cs", ".swift", ".kt", ".scala", ".dart", ".php":
-		return commentStyle{prefix: "//"}
-
-	// Hash comments: #
-	case ".py", ".rb", ".sh", ".bash", ".zsh", ".fish", ".pl", ".yaml", ".yml", ".toml",
-		".conf", ".cfg", ".ini", ".env", ".r", ".jl":
-		return commentStyle{prefix: "#"}
-
-	// Lua/SQL comments: --
-	case ".lua", ".sql", ".hs", ".elm":
-		return commentStyle{prefix: "--"}
-
-	// Lisp-style: ;
-	case ".lisp", ".el", ".clj", ".scm":
-		return commentStyle{prefix: ";"}
-
-	// Vim script: "
-	case ".vim":
-		return commentStyle{prefix: "\""}
-
-	// HTML/XML comments: <!-- -->
-	case ".html", ".htm", ".xml", ".svg":
-		return commentStyle{prefix: "<!--", suffix: "-->"}
-
-	// CSS/C block comments: /* */
-	case ".css", ".scss", ".sass", ".less":
-		return commentStyle{prefix: "/*", suffix: "*/"}
-
-	// Default to // for unknown types
-	default:
-		return commentStyle{prefix: "//"}
+// createIgnoreFileAction creates a code action that appends the finding's
+// fingerprint to the .gitleaksignore nearest to its file, or else to the one
+// in the workspace root, creating the file if it does not exist. No action
+// is offered for files outside the workspace or findings that are already
+// listed.
+func (s *Server) createIgnoreFileAction(rootPath string, diag protocol.Diagnostic, f Finding) (protocol.CodeAction, bool) {
+	if _, ok := relativePath(rootPath, f.File); !ok {
+		return protocol.CodeAction{}, false
+	}
+
+	entry := f.Fingerprint
+
+	ignoreURI := pathToURI(ignoreFileFor(rootPath, f.File))
+	newText := entry + "\n"
+
+	var edit protocol.WorkspaceEdit
+	if content, exists := s.documentContent(ignoreURI); exists {
+		for _, line := range strings.Split(content, "\n") {
+			if strings.TrimSpace(line) == entry {
+				return protocol.CodeAction{}, false
+			}
+		}
+
+		// Keep the existing last line intact
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			newText = "\n" + newText
+		}
+
+		end := NewTextBuffer(content).End()
+		edit.Changes = map[protocol.DocumentUri][]protocol.TextEdit{
+			ignoreURI: {{Range: protocol.Range{Start: end, End: end}, NewText: newText}},
+		}
+	} else {
+		ignoreIfExists := true
+		edit.DocumentChanges = []any{
+			protocol.CreateFile{
+				Kind:    "create",
+				URI:     ignoreURI,
+				Options: &protocol.CreateFileOptions{IgnoreIfExists: &ignoreIfExists},
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: ignoreURI},
+				},
+				Edits: []any{protocol.TextEdit{NewText: newText}},
+			},
+		}
 	}
+
+	kind := protocol.CodeActionKindQuickFix
+
+	return protocol.CodeAction{
+		Title:       fmt.Sprintf("Add to .gitleaksignore (%s)", entry),
+		Kind:        &kind,
+		Edit:        &edit,
+		Diagnostics: []protocol.Diagnostic{diag},
+	}, true
 }
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
@@ -45,7 +48,7 @@ func TestCreateIgnoreAction_Append(t *testing.T) {
 				},
 			}
 
-			action := createIgnoreAction("file:///test.go", diag, tt.content)
+			action := createIgnoreAction("file:///test.go", diag, tt.content, commentStyle{prefix: "//"})
 
 			// Check the edit text
 			changes := action.Edit.Changes["file:///test.go"]
@@ -62,108 +65,68 @@ func TestCreateIgnoreAction_Append(t *testing.T) {
 	}
 }
 
-func TestGetCommentSyntax(t *testing.T) {
-	tests := []struct {
-		filename       string
-		expectedPrefix string
-		expectedSuffix string
-	}{
-		// Single-line comments
-		{"test.go", "//", ""},
-		{"test.rs", "//", ""},
-		{"test.java", "//", ""},
-		{"test.js", "//", ""},
-		{"test.ts", "//", ""},
-		{"test.jsx", "//", ""},
-		{"test.tsx", "//", ""},
-		{"test.c", "//", ""},
-		{"test.cpp", "//", ""},
-		{"test.cs", "//", ""},
-		{"test.swift", "//", ""},
-		{"test.kt", "//", ""},
-		{"test.php", "//", ""},
-
-		// Hash comments
-		{"test.py", "#", ""},
-		{"test.rb", "#", ""},
-		{"test.sh", "#", ""},
-		{"test.bash", "#", ""},
-		{"test.yaml", "#", ""},
-		{"test.yml", "#", ""},
-		{"test.toml", "#", ""},
-		{"test.env", "#", ""},
-		{"test.r", "#", ""},
-
-		// Double dash
-		{"test.lua", "--", ""},
-		{"test.sql", "--", ""},
-		{"test.hs", "--", ""},
-
-		// Semicolon
-		{"test.lisp", ";", ""},
-		{"test.clj", ";", ""},
-
-		// Quote
-		{"test.vim", "\"", ""},
-
-		// Block comments
-		{"test.html", "<!--", "-->"},
-		{"test.htm", "<!--", "-->"},
-		{"test.xml", "<!--", "-->"},
-		{"test.svg", "<!--", "-->"},
-		{"test.css", "/*", "*/"},
-		{"test.scss", "/*", "*/"},
-		{"test.sass", "/*", "*/"},
-
-		// Unknown defaults to //
-		{"test.unknown", "//", ""},
-		{"README.md", "//", ""},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.filename, func(t *testing.T) {
-			style := getCommentSyntax(tt.filename)
-			assert.Equal(t, tt.expectedPrefix, style.prefix, "prefix mismatch")
-			assert.Equal(t, tt.expectedSuffix, style.suffix, "suffix mismatch")
-		})
-	}
-}
-
-func TestGetCommentSyntax_CaseInsensitive(t *testing.T) {
-	// Test that extension matching is case-insensitive
-	tests := []struct {
-		filename string
-		expected string
-	}{
-		{"Test.GO", "//"},
-		{"Test.PY", "#"},
-		{"Test.HTML", "<!--"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.filename, func(t *testing.T) {
-			style := getCommentSyntax(tt.filename)
-			assert.Equal(t, tt.expected, style.prefix)
-		})
-	}
-}
-
-func TestGetCommentSyntax_FullPaths(t *testing.T) {
-	// Test with full file paths
-	tests := []struct {
-		path     string
-		expected string
-	}{
-		{"/path/to/file.go", "//"},
-		{"/home/user/project/main.py", "#"},
-		{"C:\\Users\\test\\file.js", "//"},
-		{"./relative/path/index.html", "<!--"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.path, func(t *testing.T) {
-			style := getCommentSyntax(tt.path)
-			assert.Equal(t, tt.expected, style.prefix)
-		})
+func TestCreateIgnoreFileAction(t *testing.T) {
+	root := t.TempDir()
+	s, err := SetupServer(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ignorePath := filepath.Join(root, ".gitleaksignore")
+	ignoreURI := pathToURI(ignorePath)
+	finding := Finding{
+		RuleID:      "aws-access-token",
+		File:        filepath.Join(root, "config", "app.go"),
+		StartLine:   9,
+		Fingerprint: "config/app.go:aws-access-token:10",
 	}
+	diag := protocol.Diagnostic{}
+
+	t.Run("creates missing file", func(t *testing.T) {
+		action, ok := s.createIgnoreFileAction(root, diag, finding)
+		require.True(t, ok)
+		assert.Contains(t, action.Title, "config/app.go:aws-access-token:10")
+		require.Len(t, action.Edit.DocumentChanges, 2)
+
+		create, ok := action.Edit.DocumentChanges[0].(protocol.CreateFile)
+		require.True(t, ok)
+		assert.Equal(t, ignoreURI, create.URI)
+		assert.True(t, *create.Options.IgnoreIfExists)
+
+		edit, ok := action.Edit.DocumentChanges[1].(protocol.TextDocumentEdit)
+		require.True(t, ok)
+		assert.Equal(t, ignoreURI, edit.TextDocument.URI)
+		assert.Equal(t, "config/app.go:aws-access-token:10\n", edit.Edits[0].(protocol.TextEdit).NewText)
+	})
+
+	t.Run("appends to existing file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(ignorePath, []byte("# ignored\nother.go:generic-api-key:3"), 0644))
+
+		action, ok := s.createIgnoreFileAction(root, diag, finding)
+		require.True(t, ok)
+		require.Len(t, action.Edit.Changes[ignoreURI], 1)
+
+		edit := action.Edit.Changes[ignoreURI][0]
+		assert.Equal(t, protocol.Position{Line: 1, Character: 26}, edit.Range.Start)
+		assert.Equal(t, "\nconfig/app.go:aws-access-token:10\n", edit.NewText)
+	})
+
+	t.Run("already listed", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(ignorePath, []byte("config/app.go:aws-access-token:10\n"), 0644))
+
+		_, ok := s.createIgnoreFileAction(root, diag, finding)
+		assert.False(t, ok)
+	})
+
+	t.Run("outside workspace", func(t *testing.T) {
+		outside := finding
+		outside.File = filepath.Join(filepath.Dir(root), "elsewhere.go")
+
+		_, ok := s.createIgnoreFileAction(root, diag, outside)
+		assert.False(t, ok)
+	})
+
+	t.Run("no workspace root", func(t *testing.T) {
+		_, ok := s.createIgnoreFileAction("", diag, finding)
+		assert.False(t, ok)
+	})
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// TextBuffer is a line-indexed document buffer that applies ranged edits
+// expressed in LSP positions (line + UTF-16 code unit offset).
+// Only the lines touched by an edit are rewritten.
+type TextBuffer struct {
+	// lines holds every line including its trailing "\n"; the last line
+	// never has one (and is "" when the document ends with a newline)
+	lines []string
+}
+
+// NewTextBuffer creates a buffer from the full document text
+func NewTextBuffer(content string) *TextBuffer {
+	return &TextBuffer{lines: strings.SplitAfter(content, "\n")}
+}
+
+// String returns the full document text
+func (b *TextBuffer) String() string {
+	return strings.Join(b.lines, "")
+}
+
+// LineCount returns the number of lines in the buffer
+func (b *TextBuffer) LineCount() int {
+	return len(b.lines)
+}
+
+// Line returns the content of a line without its line terminator
+func (b *TextBuffer) Line(n int) string {
+	if n < 0 || n >= len(b.lines) {
+		return ""
+	}
+	return trimEOL(b.lines[n])
+}
+
+// End returns the position just past the last character of the document
+func (b *TextBuffer) End() protocol.Position {
+	last := len(b.lines) - 1
+	return protocol.Position{
+		Line:      uint32(last),
+		Character: uint32(utf16Length(trimEOL(b.lines[last]))),
+	}
+}
+
+// Replace sets the whole document text
+func (b *TextBuffer) Replace(content string) {
+	b.lines = strings.SplitAfter(content, "\n")
+}
+
+// Apply replaces the text in rng with text. Positions past the end of a
+// line or of the document are clamped, as the LSP specification requires.
+func (b *TextBuffer) Apply(rng protocol.Range, text string) {
+	startLine, startOff := b.offset(rng.Start)
+	endLine, endOff := b.offset(rng.End)
+
+	// Tolerate reversed ranges rather than corrupting the buffer
+	if endLine < startLine || (endLine == startLine && endOff < startOff) {
+		startLine, startOff, endLine, endOff = endLine, endOff, startLine, startOff
+	}
+
+	prefix := b.lines[startLine][:startOff]
+	suffix := b.lines[endLine][endOff:]
+
+	replacement := strings.SplitAfter(prefix+text+suffix, "\n")
+	// If the replaced lines ended with a newline, SplitAfter yields a
+	// trailing "" that belongs to the following (untouched) line
+	if endLine < len(b.lines)-1 && replacement[len(replacement)-1] == "" {
+		replacement = replacement[:len(replacement)-1]
+	}
+
+	lines := make([]string, 0, len(b.lines)-(endLine-startLine+1)+len(replacement))
+	lines = append(lines, b.lines[:startLine]...)
+	lines = append(lines, replacement...)
+	lines = append(lines, b.lines[endLine+1:]...)
+	b.lines = lines
+}
+
+// offset resolves a position to a line index and byte offset within that line
+func (b *TextBuffer) offset(pos protocol.Position) (int, int) {
+	line := int(pos.Line)
+	if line >= len(b.lines) {
+		last := len(b.lines) - 1
+		return last, len(b.lines[last])
+	}
+	return line, utf16ToByteOffset(trimEOL(b.lines[line]), int(pos.Character))
+}
+
+// utf16ToByteOffset converts a UTF-16 code unit offset within a line to a
+// byte offset, clamping to the end of the line
+func utf16ToByteOffset(line string, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return len(line)
+}
+
+// utf16Length returns the length of s in UTF-16 code units
+func utf16Length(s string) int {
+	units := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return units
+}
+
+// trimEOL strips a trailing "\n" or "\r\n"
+func trimEOL(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
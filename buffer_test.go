@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func rng(startLine, startChar, endLine, endChar uint32) protocol.Range {
+	return protocol.Range{
+		Start: protocol.Position{Line: startLine, Character: startChar},
+		End:   protocol.Position{Line: endLine, Character: endChar},
+	}
+}
+
+func TestTextBuffer_RoundTrip(t *testing.T) {
+	for _, content := range []string{"", "a", "a\n", "a\nb", "a\r\nb\r\n", "\n\n"} {
+		assert.Equal(t, content, NewTextBuffer(content).String())
+	}
+}
+
+func TestTextBuffer_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		rng      protocol.Range
+		text     string
+		expected string
+	}{
+		{"insert at start", "hello", rng(0, 0, 0, 0), ">", ">hello"},
+		{"insert at end", "hello", rng(0, 5, 0, 5), "!", "hello!"},
+		{"replace word", "hello world", rng(0, 6, 0, 11), "there", "hello there"},
+		{"insert newline", "ab", rng(0, 1, 0, 1), "\n", "a\nb"},
+		{"delete across lines", "one\ntwo\nthree\n", rng(0, 1, 2, 2), "", "oree\n"},
+		{"join lines", "one\ntwo\n", rng(0, 3, 1, 0), " ", "one two\n"},
+		{"edit middle line", "a\nb\nc\n", rng(1, 0, 1, 1), "B", "a\nB\nc\n"},
+		{"append line at eof", "a\n", rng(1, 0, 1, 0), "b\n", "a\nb\n"},
+		{"multi-line insert", "ac", rng(0, 1, 0, 1), "\nb\n", "a\nb\nc"},
+		{"clamp past end of line", "abc\ndef", rng(0, 99, 0, 99), "!", "abc!\ndef"},
+		{"clamp past end of document", "abc", rng(5, 0, 5, 0), "!", "abc!"},
+		{"crlf line end", "ab\r\ncd\r\n", rng(0, 2, 0, 2), "X", "abX\r\ncd\r\n"},
+		{"reversed range", "hello", rng(0, 4, 0, 1), "", "ho"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := NewTextBuffer(tt.content)
+			buf.Apply(tt.rng, tt.text)
+			assert.Equal(t, tt.expected, buf.String())
+			assert.Equal(t, NewTextBuffer(tt.expected).LineCount(), buf.LineCount())
+		})
+	}
+}
+
+func TestTextBuffer_ApplyUTF16(t *testing.T) {
+	// "é" is 1 UTF-16 unit (2 bytes), "😀" is 2 UTF-16 units (4 bytes)
+	buf := NewTextBuffer("é😀x")
+
+	// Character 3 is after the emoji, before "x"
+	buf.Apply(rng(0, 3, 0, 3), "-")
+	assert.Equal(t, "é😀-x", buf.String())
+
+	// Delete the emoji itself (units 1..3)
+	buf.Apply(rng(0, 1, 0, 3), "")
+	assert.Equal(t, "é-x", buf.String())
+}
+
+func TestTextBuffer_Line(t *testing.T) {
+	buf := NewTextBuffer("one\r\ntwo\nthree")
+	assert.Equal(t, 3, buf.LineCount())
+	assert.Equal(t, "one", buf.Line(0))
+	assert.Equal(t, "two", buf.Line(1))
+	assert.Equal(t, "three", buf.Line(2))
+	assert.Equal(t, "", buf.Line(3))
+	assert.Equal(t, "", buf.Line(-1))
+}
+
+func TestTextBuffer_Replace(t *testing.T) {
+	buf := NewTextBuffer("old\ncontent")
+	buf.Replace("new")
+	assert.Equal(t, "new", buf.String())
+	assert.Equal(t, 1, buf.LineCount())
+}
+
+func TestTextBuffer_End(t *testing.T) {
+	assert.Equal(t, protocol.Position{Line: 0, Character: 0}, NewTextBuffer("").End())
+	assert.Equal(t, protocol.Position{Line: 1, Character: 0}, NewTextBuffer("a\n").End())
+	assert.Equal(t, protocol.Position{Line: 1, Character: 3}, NewTextBuffer("a\né😀").End())
+}
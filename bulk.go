@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// codeActionKindFixAll is the kind of the action that ignores every finding
+// of a document, for editors that run it on save. Clients asking for
+// source.fixAll or source in general do not get it, so that fixing all
+// problems on save does not hide secrets.
+const codeActionKindFixAll = protocol.CodeActionKind("source.fixAll.gitleaks")
+
+// bulkIgnoreActions returns the actions that add many findings to
+// .gitleaksignore at once: all findings of the document at uri, and all
+// findings of the rules of diagnostics in the document and in the last
+// workspace scan. Rule actions are only offered when they cover more than
+// the narrower scope does, and the action for the document when it covers
+// more than one finding or the client asked for codeActionKindFixAll by
+// name. It is not offered when the client asks for other kinds.
+func (s *Server) bulkIgnoreActions(uri protocol.DocumentUri, diagnostics []protocol.Diagnostic, only []protocol.CodeActionKind) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+
+	findings := s.fileFindings(uri)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	// Group the diagnostics in the range by rule, in order
+	var rules []string
+	ruleDiagnostics := make(map[string][]protocol.Diagnostic)
+	for _, diag := range diagnostics {
+		f, ok := s.findFinding(uri, findingIDFromDiagnostic(diag))
+		if !ok {
+			continue
+		}
+		if _, seen := ruleDiagnostics[f.RuleID]; !seen {
+			rules = append(rules, f.RuleID)
+		}
+		ruleDiagnostics[f.RuleID] = append(ruleDiagnostics[f.RuleID], diag)
+	}
+
+	for _, ruleID := range rules {
+		inFile := filterFindings(findings, ruleID)
+		if len(inFile) > 1 {
+			title := fmt.Sprintf("Ignore all %d findings of %s in this file (.gitleaksignore)", len(inFile), ruleID)
+			if action, ok := s.bulkIgnoreAction(title, protocol.CodeActionKindQuickFix, inFile, ruleDiagnostics[ruleID]); ok {
+				actions = append(actions, action)
+			}
+		}
+
+		inWorkspace := filterFindings(s.workspaceFindings(), ruleID)
+		if len(inWorkspace) > len(inFile) {
+			title := fmt.Sprintf("Ignore all %d findings of %s in the workspace (.gitleaksignore)", len(inWorkspace), ruleID)
+			if action, ok := s.bulkIgnoreAction(title, protocol.CodeActionKindQuickFix, inWorkspace, ruleDiagnostics[ruleID]); ok {
+				actions = append(actions, action)
+			}
+		}
+	}
+
+	if (len(only) == 0 && len(findings) > 1) || slices.Contains(only, codeActionKindFixAll) {
+		title := fmt.Sprintf("Ignore all %d findings in this file (.gitleaksignore)", len(findings))
+		if len(findings) == 1 {
+			title = "Ignore all findings in this file (.gitleaksignore)"
+		}
+		if action, ok := s.bulkIgnoreAction(title, codeActionKindFixAll, findings, nil); ok {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions
+}
+
+// bulkIgnoreAction creates a code action that adds findings to
+// .gitleaksignore with a single edit, or reports false if all of them
+// are listed already
+func (s *Server) bulkIgnoreAction(title string, kind protocol.CodeActionKind, findings []Finding, diagnostics []protocol.Diagnostic) (protocol.CodeAction, bool) {
+	edit, ok := s.ignoreFindingsEdit(findings)
+	if !ok {
+		return protocol.CodeAction{}, false
+	}
+
+	return protocol.CodeAction{
+		Title:       title,
+		Kind:        &kind,
+		Edit:        edit,
+		Diagnostics: diagnostics,
+	}, true
+}
+
+// ignoreFindingsEdit returns an edit appending the fingerprints of findings
+// to the .gitleaksignore nearest to each, in the workspace folder of each,
+// creating files as needed. Findings outside the workspace and fingerprints
+// already listed are left out; false is returned if none are left.
+func (s *Server) ignoreFindingsEdit(findings []Finding) (*protocol.WorkspaceEdit, bool) {
+	var ignorePaths []string
+	entries := make(map[string][]string)
+	listed := make(map[string]map[string]bool)
+
+	for _, f := range findings {
+		rootPath := s.folderFor(pathToURI(f.File)).rootPath()
+		if _, ok := relativePath(rootPath, f.File); !ok {
+			continue
+		}
+
+		ignorePath := ignoreFileFor(rootPath, f.File)
+		if _, ok := listed[ignorePath]; !ok {
+			ignorePaths = append(ignorePaths, ignorePath)
+			listed[ignorePath] = make(map[string]bool)
+			content, _ := s.documentContent(pathToURI(ignorePath))
+			for _, line := range strings.Split(content, "\n") {
+				listed[ignorePath][strings.TrimSpace(line)] = true
+			}
+		}
+
+		// Findings on one line share a fingerprint
+		if !listed[ignorePath][f.Fingerprint] {
+			listed[ignorePath][f.Fingerprint] = true
+			entries[ignorePath] = append(entries[ignorePath], f.Fingerprint)
+		}
+	}
+
+	var changes []any
+	for _, ignorePath := range ignorePaths {
+		if len(entries[ignorePath]) > 0 {
+			text := strings.Join(entries[ignorePath], "\n") + "\n"
+			changes = append(changes, s.appendFileChanges(pathToURI(ignorePath), text)...)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, false
+	}
+	return &protocol.WorkspaceEdit{DocumentChanges: changes}, true
+}
+
+// ignoreFileFor returns the .gitleaksignore that applies to file: the
+// nearest one, or else the one to create in the workspace root. A nested
+// ignore file hides the root one from the scanner.
+func ignoreFileFor(rootPath, file string) string {
+	if ignorePath := findNearest(rootPath, filepath.Dir(file), findIgnoreFile); ignorePath != "" {
+		return ignorePath
+	}
+	return filepath.Join(rootPath, ".gitleaksignore")
+}
+
+// fileFindings returns the current findings of the document at uri: those
+// of the open document, or else those of the last workspace scan
+func (s *Server) fileFindings(uri protocol.DocumentUri) []Finding {
+	if doc, ok := s.documents.Get(uri); ok {
+		return doc.Findings
+	}
+	if result := s.getWorkspaceResult(); result != nil {
+		return result.Findings[uri]
+	}
+	return nil
+}
+
+// workspaceFindings returns the findings of the last workspace scan and of
+// the open documents, with those of open documents as they are now. It
+// returns nil if the workspace has not been scanned.
+func (s *Server) workspaceFindings() []Finding {
+	result := s.getWorkspaceResult()
+	if result == nil {
+		return nil
+	}
+
+	uris := slices.Collect(maps.Keys(result.Findings))
+	for _, doc := range s.documents.All() {
+		if _, ok := result.Findings[doc.URI]; !ok {
+			uris = append(uris, doc.URI)
+		}
+	}
+	slices.Sort(uris)
+
+	var findings []Finding
+	for _, uri := range uris {
+		findings = append(findings, s.fileFindings(uri)...)
+	}
+	return findings
+}
+
+// filterFindings returns the findings of a rule
+func filterFindings(findings []Finding, ruleID string) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if f.RuleID == ruleID {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// codeActionKindRequested reports whether kind is one of the kinds a
+// client asked for, or a sub-kind of one of them
+func codeActionKindRequested(only []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(string(kind), string(requested)+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -9,6 +9,7 @@ import (
 type Cache struct {
 	mu      sync.RWMutex
 	entries map[[32]byte][]Finding
+	epoch   uint64 // incremented on every Clear
 }
 
 // NewCache creates a new result cache
@@ -40,6 +41,15 @@ func (c *Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.entries = make(map[[32]byte][]Finding)
+	c.epoch++
+}
+
+// Epoch returns a counter that changes whenever the cache is cleared, so
+// results derived from cached entries can be invalidated
+func (c *Cache) Epoch() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.epoch
 }
 
 // Size returns the number of entries in the cache
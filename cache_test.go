@@ -128,3 +128,14 @@ func TestCache_Concurrent(t *testing.T) {
 		}
 	}
 }
+
+func TestCache_Epoch(t *testing.T) {
+	cache := NewCache()
+	epoch := cache.Epoch()
+
+	cache.Put("content", []Finding{{RuleID: "test"}})
+	assert.Equal(t, epoch, cache.Epoch(), "Put should not change the epoch")
+
+	cache.Clear()
+	assert.NotEqual(t, epoch, cache.Epoch(), "Clear should change the epoch")
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+// Exit codes of the command line mode
+const (
+	exitOK       = 0
+	exitFindings = 1 // secrets found, or check-config found the config invalid
+	exitError    = 2 // usage or runtime error, or a scan with an invalid config
+)
+
+// cliUsage is printed by the help subcommand and on usage errors
+const cliUsage = `Usage:
+  gitleaks-ls                      Run the language server over stdio
+  gitleaks-ls scan [flags] [path]  Scan a directory (default ".") for secrets
+  gitleaks-ls check-config [path]  Validate the gitleaks config of a directory
+  gitleaks-ls version              Print the version
+
+Exit codes: 0 no secrets, 1 secrets found or invalid config, 2 error.
+A scan fails with 2 if the config is invalid instead of using the defaults.
+Run "gitleaks-ls scan -h" for scan flags.
+`
+
+// CLIFinding is a finding as printed by the scan subcommand. Lines and
+// columns are 1-based and the file is relative to the scanned directory.
+// The secret is left out so that CI logs do not repeat it.
+type CLIFinding struct {
+	RuleID      string `json:"ruleId"`
+	Description string `json:"description"`
+	File        string `json:"file"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// runCLI runs the subcommand named by args and returns its exit code. ok is
+// false if args name no subcommand, e.g. the --stdio flag editors pass, in
+// which case the language server should run.
+func runCLI(args []string, stdout, stderr io.Writer) (code int, ok bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "scan":
+		return runScan(args[1:], stdout, stderr), true
+	case "check-config":
+		return runCheckConfig(args[1:], stdout, stderr), true
+	case "version":
+		fmt.Fprintf(stdout, "%s %s\n", lsName, version)
+		return exitOK, true
+	case "help":
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK, true
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return exitError, true
+	}
+}
+
+// runScan implements the scan subcommand
+func runScan(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "output format: text or json")
+	staged := flags.Bool("staged", false, "scan only the changes staged for commit")
+	verbose := flags.Bool("verbose", false, "log progress to stderr")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return exitError
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return exitError
+	}
+
+	setupCLILogging(stderr, *verbose)
+
+	rootPath, err := cliRoot(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	s, err := newCLIServer(rootPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	defer s.cancel()
+
+	var result *WorkspaceScanResult
+	if *staged {
+		result, err = s.ScanStaged(s.ctx, rootPath)
+	} else {
+		result, err = s.ScanWorkspace(s.ctx, rootPath, nil)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "scan failed: %v\n", err)
+		return exitError
+	}
+
+	// A config that cannot be loaded is replaced by the defaults, so the
+	// scan did not use the rules of the project and must not pass
+	failed := false
+	for _, c := range s.getFolders()[0].loadedConfigs() {
+		if err := c.Err(); err != nil {
+			printConfigError(stderr, c.Path(), err)
+			failed = true
+		}
+	}
+	if failed {
+		fmt.Fprintln(stderr, "scan failed: invalid config")
+		return exitError
+	}
+
+	findings := cliFindings(rootPath, result)
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintf(stdout, "%s:%d:%d: %s: %s\n", f.File, f.StartLine, f.StartColumn, f.RuleID, f.Description)
+		}
+	}
+
+	if result.TotalFindings == 0 {
+		fmt.Fprintf(stderr, "no secrets found (%d files scanned)\n", result.ScannedFiles)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "%d secrets found in %d files (%d files scanned)\n",
+		result.TotalFindings, len(result.Findings), result.ScannedFiles)
+	return exitFindings
+}
+
+// runCheckConfig implements the check-config subcommand
+func runCheckConfig(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return exitError
+	}
+
+	setupCLILogging(stderr, false)
+
+	rootPath, err := cliRoot(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	// The config is found as for the scan subcommand
+	var cfg config.Config
+	path, toml, source := resolveConfig(rootPath, NewServerSettings())
+	switch source {
+	case ConfigSourceDefault:
+		fmt.Fprintf(stdout, "no .gitleaks.toml in %s, the default rules apply\n", rootPath)
+		return exitOK
+	case ConfigSourceEnvTOML:
+		path = "GITLEAKS_CONFIG_TOML"
+		cfg, err = ValidateConfigTOML(toml)
+	default:
+		cfg, err = ValidateConfigFile(path)
+	}
+	if err != nil {
+		printConfigError(stderr, path, err)
+		return exitFindings
+	}
+
+	fmt.Fprintf(stdout, "%s: ok (%d rules)\n", path, len(cfg.Rules))
+	return exitOK
+}
+
+// printConfigError prints an error of the config at path, or in
+// GITLEAKS_CONFIG_TOML if path is "". Errors in a file already start with
+// its path and position.
+func printConfigError(w io.Writer, path string, err error) {
+	if path == "" {
+		path = "GITLEAKS_CONFIG_TOML"
+	}
+	var ce *configError
+	if errors.As(err, &ce) {
+		fmt.Fprintln(w, err)
+	} else {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+	}
+}
+
+// setupCLILogging keeps the server's logs out of command output unless
+// verbose is set
+func setupCLILogging(stderr io.Writer, verbose bool) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// cliRoot resolves the directory argument of a subcommand
+func cliRoot(arg string) (string, error) {
+	if arg == "" {
+		arg = "."
+	}
+	path, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", arg)
+	}
+	return path, nil
+}
+
+// newCLIServer creates a server for a single command line run. The config,
+// ignore file and baseline are found as for an editor workspace rooted at
+// rootPath, but nothing is watched and there is no client.
+func newCLIServer(rootPath string) (*Server, error) {
+	s := NewServer()
+	folder, err := NewWorkspaceFolder(rootPath, filepath.Base(rootPath), s.settings, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.folders = []*WorkspaceFolder{folder}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// cliFindings flattens the findings of a scan, sorted by file and position
+func cliFindings(rootPath string, result *WorkspaceScanResult) []CLIFinding {
+	findings := make([]CLIFinding, 0, result.TotalFindings)
+	for _, fileFindings := range result.Findings {
+		for _, f := range fileFindings {
+			findings = append(findings, CLIFinding{
+				RuleID:      f.RuleID,
+				Description: f.Description,
+				File:        fingerprintPath(rootPath, f.File),
+				StartLine:   f.StartLine + 1,
+				StartColumn: int(adjustColumn(f.StartColumn, f.StartLine, false)) + 1,
+				EndLine:     f.EndLine + 1,
+				Fingerprint: f.Fingerprint,
+			})
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b CLIFinding) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine - b.StartLine
+		}
+		return a.StartColumn - b.StartColumn
+	})
+	return findings
+}
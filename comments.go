@@ -0,0 +1,294 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// commentStyle represents comment syntax for a language
+type commentStyle struct {
+	prefix string // starts the ignore comment
+	suffix string // empty if single-line comment
+
+	block        [2]string      // block comment delimiters of a language with line comments
+	quotes       []quote        // string literals, longer openers first
+	heredoc      *regexp.Regexp // opens a here-document, the last group is its terminator
+	blockScalars bool           // YAML block scalars (| and >)
+}
+
+// quote is the syntax of a string literal
+type quote struct {
+	open, close string
+	multiline   bool // may span lines
+	raw         bool // backslash does not escape
+}
+
+// String literal syntaxes shared by several languages
+var (
+	cQuotes      = []quote{{open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	goQuotes     = []quote{{open: "`", close: "`", multiline: true, raw: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	jsQuotes     = []quote{{open: "`", close: "`", multiline: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	tripleQuotes = []quote{{open: `"""`, close: `"""`, multiline: true}, {open: `'''`, close: `'''`, multiline: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	tomlQuotes   = []quote{{open: `"""`, close: `"""`, multiline: true}, {open: `'''`, close: `'''`, multiline: true, raw: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`, raw: true}}
+	shellQuotes  = []quote{{open: `"`, close: `"`, multiline: true}, {open: `'`, close: `'`, multiline: true, raw: true}}
+	spanQuotes   = []quote{{open: `"`, close: `"`, multiline: true}, {open: `'`, close: `'`, multiline: true}}
+	csQuotes     = []quote{{open: `"""`, close: `"""`, multiline: true, raw: true}, {open: `@"`, close: `"`, multiline: true, raw: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	luaQuotes    = []quote{{open: "[[", close: "]]", multiline: true, raw: true}, {open: `"`, close: `"`}, {open: `'`, close: `'`}}
+	psQuotes     = []quote{{open: `@"`, close: `"@`, multiline: true, raw: true}, {open: `@'`, close: `'@`, multiline: true, raw: true}, {open: `"`, close: `"`, multiline: true, raw: true}, {open: `'`, close: `'`, multiline: true, raw: true}}
+)
+
+// Here-document openers: shell and HCL (<<EOF, <<-EOF, <<'EOF'), Ruby
+// (<<~EOS) and PHP (<<<EOT)
+var (
+	shellHeredoc = regexp.MustCompile(`(?:^|[^<])<<-?\s*['"]?([A-Za-z_]\w*)['"]?`)
+	rubyHeredoc  = regexp.MustCompile(`<<[-~]?(['"]?)([A-Z_]\w*)`)
+	phpHeredoc   = regexp.MustCompile(`<<<\s*['"]?([A-Za-z_]\w*)['"]?`)
+)
+
+// commentLanguages lists the comment syntax of each language by LSP
+// languageId, file name pattern and extension. A nil style marks formats
+// where a comment cannot follow code, like JSON or Dockerfile. Rows are
+// split where envStyles differ.
+var commentLanguages = []struct {
+	ids        []string
+	names      []string // base names, matched case-insensitively with path.Match
+	extensions []string
+	style      *commentStyle
+}{
+	{[]string{"go"}, nil, []string{".go"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: goQuotes}},
+	{[]string{"c", "cpp", "objective-c", "objective-cpp", "cuda-cpp", "proto", "proto3"}, nil,
+		[]string{".c", ".cc", ".cpp", ".cxx", ".h", ".hh", ".hpp", ".hxx", ".m", ".mm", ".cu", ".proto"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: cQuotes}},
+	{[]string{"java", "kotlin", "scala", "groovy"}, []string{"Jenkinsfile"},
+		[]string{".java", ".kt", ".kts", ".scala", ".sc", ".groovy", ".gradle"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: tripleQuotes}},
+	{[]string{"swift", "dart"}, nil, []string{".swift", ".dart"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: tripleQuotes}},
+	{[]string{"javascript", "javascriptreact", "typescript", "typescriptreact"}, nil,
+		[]string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: jsQuotes}},
+	{[]string{"rust"}, nil, []string{".rs"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: []quote{{open: `"`, close: `"`, multiline: true}}}},
+	{[]string{"csharp"}, nil, []string{".cs"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: csQuotes}},
+	{[]string{"php"}, nil, []string{".php"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: spanQuotes, heredoc: phpHeredoc}},
+	{[]string{"jsonc", "json5"}, []string{"tsconfig.json", "tsconfig.*.json", "jsconfig.json", "devcontainer.json", ".devcontainer.json"},
+		[]string{".jsonc", ".json5"},
+		&commentStyle{prefix: "//", block: [2]string{"/*", "*/"}, quotes: cQuotes}},
+	{[]string{"json", "jsonl"}, nil, []string{".json", ".jsonl", ".ipynb"}, nil},
+
+	{[]string{"python"}, nil, []string{".py", ".pyi", ".pyw"},
+		&commentStyle{prefix: "#", quotes: tripleQuotes}},
+	{[]string{"ruby"}, []string{"Gemfile", "Rakefile", "Vagrantfile", "Podfile", "Fastfile", "Brewfile"},
+		[]string{".rb", ".rake", ".gemspec"},
+		&commentStyle{prefix: "#", quotes: spanQuotes, heredoc: rubyHeredoc}},
+	{[]string{"shellscript"}, []string{".bashrc", ".bash_profile", ".zshrc", ".zprofile", ".profile", ".envrc"},
+		[]string{".sh", ".bash", ".zsh", ".ksh"},
+		&commentStyle{prefix: "#", quotes: shellQuotes, heredoc: shellHeredoc}},
+	{[]string{"fish"}, nil, []string{".fish"},
+		&commentStyle{prefix: "#", quotes: shellQuotes}},
+	{[]string{"perl"}, nil, []string{".pl", ".pm"},
+		&commentStyle{prefix: "#", quotes: spanQuotes, heredoc: shellHeredoc}},
+	{[]string{"yaml", "dockercompose"}, nil, []string{".yaml", ".yml"},
+		&commentStyle{prefix: "#", quotes: cQuotes, blockScalars: true}},
+	{[]string{"toml"}, nil, []string{".toml"},
+		&commentStyle{prefix: "#", quotes: tomlQuotes}},
+	{[]string{"dotenv"}, []string{".env", ".env.*", "*.env"}, []string{".env"},
+		&commentStyle{prefix: "#", quotes: cQuotes}},
+	{[]string{"ini"}, []string{".editorconfig", ".gitconfig", ".npmrc"}, []string{".ini", ".cfg", ".conf"},
+		&commentStyle{prefix: "#"}},
+	{[]string{"makefile"}, []string{"Makefile", "makefile", "GNUmakefile"}, []string{".mk", ".mak"},
+		&commentStyle{prefix: "#"}},
+	{[]string{"terraform", "terraform-vars", "hcl"}, nil, []string{".tf", ".tfvars", ".hcl", ".nomad"},
+		&commentStyle{prefix: "#", block: [2]string{"/*", "*/"}, quotes: []quote{{open: `"`, close: `"`}}, heredoc: shellHeredoc}},
+	{[]string{"powershell"}, nil, []string{".ps1", ".psm1", ".psd1"},
+		&commentStyle{prefix: "#", block: [2]string{"<#", "#>"}, quotes: psQuotes}},
+	{[]string{"r", "julia"}, nil, []string{".r", ".jl"},
+		&commentStyle{prefix: "#", quotes: spanQuotes}},
+	{[]string{"elixir"}, nil, []string{".ex", ".exs"},
+		&commentStyle{prefix: "#", quotes: tripleQuotes}},
+	{[]string{"graphql"}, nil, []string{".graphql", ".gql"},
+		&commentStyle{prefix: "#", quotes: tripleQuotes}},
+	{[]string{"properties"}, nil, []string{".properties"}, nil},
+	{[]string{"dockerfile"}, []string{"Dockerfile", "Containerfile", "Dockerfile.*", "*.Dockerfile"}, []string{".dockerfile"}, nil},
+	{[]string{"bat"}, nil, []string{".bat", ".cmd"}, nil},
+
+	{[]string{"lua"}, nil, []string{".lua"},
+		&commentStyle{prefix: "--", block: [2]string{"--[[", "]]"}, quotes: luaQuotes}},
+	{[]string{"sql"}, nil, []string{".sql"},
+		&commentStyle{prefix: "--", block: [2]string{"/*", "*/"}, quotes: []quote{{open: `'`, close: `'`, multiline: true}}}},
+	{[]string{"haskell", "elm"}, nil, []string{".hs", ".elm"},
+		&commentStyle{prefix: "--", block: [2]string{"{-", "-}"}, quotes: []quote{{open: `"`, close: `"`}}}},
+	{[]string{"lisp", "clojure", "scheme"}, nil, []string{".lisp", ".el", ".clj", ".cljs", ".edn", ".scm"},
+		&commentStyle{prefix: ";", quotes: []quote{{open: `"`, close: `"`, multiline: true}}}},
+	{[]string{"vim"}, []string{".vimrc"}, []string{".vim"},
+		&commentStyle{prefix: "\"", quotes: []quote{{open: `'`, close: `'`, raw: true}}}},
+
+	{[]string{"html", "xml", "markdown", "svg"}, nil, []string{".html", ".htm", ".xhtml", ".xml", ".svg", ".md", ".markdown"},
+		&commentStyle{prefix: "<!--", suffix: "-->"}},
+	{[]string{"css", "scss", "sass", "less"}, nil, []string{".css", ".scss", ".sass", ".less"},
+		&commentStyle{prefix: "/*", suffix: "*/", quotes: cQuotes}},
+}
+
+// languagesByID and languagesByExtension index commentLanguages
+var (
+	languagesByID        = make(map[string]int)
+	languagesByExtension = make(map[string]int)
+)
+
+func init() {
+	for i, language := range commentLanguages {
+		for _, id := range language.ids {
+			languagesByID[id] = i
+		}
+		for _, ext := range language.extensions {
+			languagesByExtension[ext] = i
+		}
+	}
+}
+
+// findLanguage returns the index in commentLanguages of a document by its
+// LSP languageId, which may be empty, or else by its file name and
+// extension
+func findLanguage(languageID, filename string) (int, bool) {
+	if i, ok := languagesByID[languageID]; ok {
+		return i, true
+	}
+
+	// Names and extensions may be written with either separator
+	base := strings.ToLower(filepath.Base(strings.ReplaceAll(filename, "\\", "/")))
+	for i, language := range commentLanguages {
+		for _, name := range language.names {
+			if matched, _ := path.Match(strings.ToLower(name), base); matched {
+				return i, true
+			}
+		}
+	}
+
+	i, ok := languagesByExtension[strings.ToLower(path.Ext(base))]
+	return i, ok
+}
+
+// getCommentSyntax returns the comment syntax of a document by its LSP
+// languageId, which may be empty, or else by its file name and extension.
+// It reports false for formats and files where an ignore comment cannot
+// be placed after code.
+func getCommentSyntax(languageID, filename string) (commentStyle, bool) {
+	i, ok := findLanguage(languageID, filename)
+	if !ok || commentLanguages[i].style == nil {
+		return commentStyle{}, false
+	}
+	return *commentLanguages[i].style, true
+}
+
+// inlineCommentSafe reports whether a comment can be appended to line of
+// content without changing what the code means: the line must not end
+// inside a string, here-document or YAML block scalar, continue on the
+// next line, or end inside a comment the appended one would close.
+func inlineCommentSafe(content string, line uint32, style commentStyle) bool {
+	lineComment, block := style.prefix, style.block
+	if style.suffix != "" {
+		lineComment, block = "", [2]string{style.prefix, style.suffix}
+	}
+
+	var (
+		open         *quote // string the line ends in
+		inBlock      bool   // block comment the line ends in
+		heredoc      string // terminator of the here-document being read
+		scalarIndent = -1   // indentation of the key of a YAML block scalar
+	)
+
+	lines := strings.Split(content, "\n")
+	for n := 0; n <= int(line) && n < len(lines); n++ {
+		text := strings.TrimSuffix(lines[n], "\r")
+
+		if heredoc != "" {
+			if strings.TrimSpace(text) == heredoc {
+				heredoc = ""
+			}
+			if n == int(line) {
+				return false
+			}
+			continue
+		}
+		if scalarIndent >= 0 {
+			if strings.TrimSpace(text) == "" || indentation(text) > scalarIndent {
+				if n == int(line) {
+					return false
+				}
+				continue
+			}
+			scalarIndent = -1
+		}
+
+		for i := 0; i < len(text); {
+			rest := text[i:]
+			switch {
+			case open != nil:
+				if !open.raw && rest[0] == '\\' {
+					i += 2
+				} else if strings.HasPrefix(rest, open.close) {
+					i += len(open.close)
+					open = nil
+				} else {
+					i++
+				}
+			case inBlock:
+				if strings.HasPrefix(rest, block[1]) {
+					i += len(block[1])
+					inBlock = false
+				} else {
+					i++
+				}
+			case block[0] != "" && strings.HasPrefix(rest, block[0]):
+				i += len(block[0])
+				inBlock = true
+			case lineComment != "" && strings.HasPrefix(rest, lineComment):
+				i = len(text)
+			default:
+				i++
+				for q := range style.quotes {
+					if strings.HasPrefix(rest, style.quotes[q].open) {
+						open = &style.quotes[q]
+						i += len(open.open) - 1
+						break
+					}
+				}
+			}
+		}
+
+		// An unterminated single-line string is not a string after all
+		if open != nil && !open.multiline {
+			open = nil
+		}
+
+		if n == int(line) {
+			if open != nil || (inBlock && style.suffix != "") {
+				return false
+			}
+			return !strings.HasSuffix(strings.TrimRight(text, " \t"), "\\")
+		}
+
+		if open == nil && !inBlock && style.heredoc != nil {
+			if m := style.heredoc.FindStringSubmatch(text); m != nil {
+				heredoc = m[len(m)-1]
+			}
+		}
+		if style.blockScalars && yamlBlockScalar.MatchString(text) {
+			scalarIndent = indentation(text)
+		}
+	}
+	return true
+}
+
+// yamlBlockScalar matches a line whose value is a block scalar
+var yamlBlockScalar = regexp.MustCompile(`(?:^|[:-])\s*[|>][-+0-9]*\s*(?:#.*)?$`)
+
+// indentation returns the number of leading spaces and tabs of a line
+func indentation(text string) int {
+	return len(text) - len(strings.TrimLeft(text, " \t"))
+}
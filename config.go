@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -14,30 +15,71 @@ import (
 	"github.com/zricethezav/gitleaks/v8/config"
 )
 
+// baselineNames are the conventional names of a baseline report in the workspace root
+var baselineNames = []string{"gitleaks-baseline.json", ".gitleaks-baseline.json"}
+
+// configNames are the locations of a config in a project, in order of precedence
+var configNames = []string{".gitleaks.toml", filepath.Join(".gitleaks", "config.toml")}
+
+// ConfigSource tells where the config of a workspace folder came from
+type ConfigSource string
+
+const (
+	ConfigSourceSetting   ConfigSource = "setting"              // the configPath setting
+	ConfigSourceEnv       ConfigSource = "GITLEAKS_CONFIG"      // a path in the environment
+	ConfigSourceEnvTOML   ConfigSource = "GITLEAKS_CONFIG_TOML" // the config itself in the environment
+	ConfigSourceWorkspace ConfigSource = "workspace"            // a config file in the project
+	ConfigSourceDefault   ConfigSource = "default"              // the gitleaks default rules
+)
+
 // Config manages gitleaks configuration
 type Config struct {
 	mu       sync.RWMutex
-	path     string
-	rootPath string // workspace root path
+	path     string       // "" for the defaults and GITLEAKS_CONFIG_TOML
+	toml     string       // config content from GITLEAKS_CONFIG_TOML
+	source   ConfigSource // where path or toml came from
+	rootPath string       // workspace root path
+	settings *ServerSettings
 	cfg      config.Config
+	err      error    // why path or toml could not be loaded
+	files    []string // path and the files it extends
+	resolved bool     // path was found by resolveConfig, which Refresh repeats
 	watcher  *fsnotify.Watcher
 	onReload func() // Callback when config changes
 }
 
-// NewConfig loads config from path or uses defaults
-func NewConfig(workspaceRoot string, onReload func()) (*Config, error) {
+// NewConfig resolves and loads the config of a workspace, see
+// resolveConfig. The configPath and baselinePath settings are read from
+// settings.
+func NewConfig(workspaceRoot string, settings *ServerSettings, onReload func()) (*Config, error) {
 	c := &Config{
 		onReload: onReload,
 		rootPath: workspaceRoot,
+		settings: settings,
+		resolved: true,
+	}
+	c.path, c.toml, c.source = resolveConfig(workspaceRoot, settings)
+	slog.Info("resolved gitleaks config", "root", workspaceRoot, "source", c.source, "path", c.path)
+
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
 	}
 
-	// Look for .gitleaks.toml in workspace root
-	configPath := filepath.Join(workspaceRoot, ".gitleaks.toml")
-	if _, err := os.Stat(configPath); err == nil {
-		c.path = configPath
-		slog.Info("found gitleaks config", "path", configPath)
-	} else {
-		slog.Info("no gitleaks config found, using defaults")
+	return c, nil
+}
+
+// NewConfigAt loads the config at configPath, or the defaults if it is "",
+// for a workspace rooted at workspaceRoot
+func NewConfigAt(configPath, workspaceRoot string, settings *ServerSettings, onReload func()) (*Config, error) {
+	c := &Config{
+		path:     configPath,
+		source:   ConfigSourceWorkspace,
+		onReload: onReload,
+		rootPath: workspaceRoot,
+		settings: settings,
+	}
+	if configPath == "" {
+		c.source = ConfigSourceDefault
 	}
 
 	if err := c.load(); err != nil {
@@ -47,46 +89,209 @@ func NewConfig(workspaceRoot string, onReload func()) (*Config, error) {
 	return c, nil
 }
 
-// load reads the configuration
-func (c *Config) load() error {
-	v := viper.New()
-	v.SetConfigType("toml")
-
-	if c.path != "" {
-		v.SetConfigFile(c.path)
-		if err := v.ReadInConfig(); err != nil {
-			slog.Warn("failed to load config, using defaults", "path", c.path, "error", err)
-			// Fallback to defaults
-			if err := v.ReadConfig(strings.NewReader(config.DefaultConfig)); err != nil {
-				return fmt.Errorf("reading default config: %w", err)
-			}
+// resolveConfig finds the config of the workspace rooted at rootPath in
+// the order the gitleaks CLI uses: the configPath setting, which is
+// resolved against the root, then the GITLEAKS_CONFIG and
+// GITLEAKS_CONFIG_TOML environment variables, then a config in the root.
+// It returns the path of the config file or the content of
+// GITLEAKS_CONFIG_TOML, and where it came from.
+func resolveConfig(rootPath string, settings *ServerSettings) (path, toml string, source ConfigSource) {
+	if path := settings.ConfigPath(); path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(rootPath, path)
 		}
-	} else {
-		if err := v.ReadConfig(strings.NewReader(config.DefaultConfig)); err != nil {
-			return fmt.Errorf("reading default config: %w", err)
+		return path, "", ConfigSourceSetting
+	}
+	if path := os.Getenv("GITLEAKS_CONFIG"); path != "" {
+		return path, "", ConfigSourceEnv
+	}
+	if toml := os.Getenv("GITLEAKS_CONFIG_TOML"); toml != "" {
+		return "", toml, ConfigSourceEnvTOML
+	}
+	if path := findConfigFile(rootPath); path != "" {
+		return path, "", ConfigSourceWorkspace
+	}
+	return "", "", ConfigSourceDefault
+}
+
+// findConfigFile looks for .gitleaks.toml or .gitleaks/config.toml in dir
+func findConfigFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for _, name := range configNames {
+		configFile := filepath.Join(dir, name)
+		if _, err := os.Stat(configFile); err == nil {
+			return configFile
 		}
 	}
+	return ""
+}
 
-	var vc config.ViperConfig
-	if err := v.Unmarshal(&vc); err != nil {
-		return fmt.Errorf("unmarshaling config: %w", err)
+// Path returns the file the config is loaded from, or "" if there is none
+func (c *Config) Path() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.path
+}
+
+// Source returns where the config came from
+func (c *Config) Source() ConfigSource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.source
+}
+
+// explicit reports whether the config was named by the setting or the
+// environment rather than found in the workspace. Like the CLI's --config,
+// it then applies to the whole workspace.
+func (c *Config) explicit() bool {
+	switch c.Source() {
+	case ConfigSourceSetting, ConfigSourceEnv, ConfigSourceEnvTOML:
+		return true
 	}
+	return false
+}
 
-	cfg, err := vc.Translate()
-	if err != nil {
-		return fmt.Errorf("translating config: %w", err)
+// Refresh resolves the config again, e.g. after the configPath setting
+// changed, and loads and watches the new one if the resolution changed.
+// It reports whether it did.
+func (c *Config) Refresh() (bool, error) {
+	path, toml, source := resolveConfig(c.rootPath, c.settings)
+
+	c.mu.Lock()
+	if path == c.path && toml == c.toml && source == c.source {
+		c.mu.Unlock()
+		return false, nil
 	}
+	c.path, c.toml, c.source = path, toml, source
+	c.mu.Unlock()
+
+	slog.Info("resolved gitleaks config", "root", c.rootPath, "source", source, "path", path)
 
-	if c.path != "" {
-		cfg.Path = c.path
+	if err := c.load(); err != nil {
+		return true, fmt.Errorf("loading config: %w", err)
+	}
+	return true, nil
+}
+
+// load reads the configuration and the configs it extends. If they cannot
+// be read the defaults are used and the error is kept for Err.
+func (c *Config) load() error {
+	c.mu.RLock()
+	path, toml := c.path, c.toml
+	c.mu.RUnlock()
+
+	var (
+		cfg     config.Config
+		files   []string
+		loadErr error
+	)
+	switch {
+	case path != "":
+		cfg, files, loadErr = readConfigChain(path)
+	case toml != "":
+		cfg, files, loadErr = readConfigContent(toml)
+	}
+	if loadErr != nil {
+		slog.Warn("failed to load config, using defaults", "path", path, "error", loadErr)
+	}
+
+	// Fallback to defaults
+	if loadErr != nil || (path == "" && toml == "") {
+		var err error
+		if cfg, err = defaultConfig(); err != nil {
+			return err
+		}
+	}
+
+	if path != "" {
+		cfg.Path = path
 	}
 
 	c.mu.Lock()
 	c.cfg = cfg
+	c.err = loadErr
+	oldFiles := c.files
+	c.files = files
+	watcher := c.watcher
 	c.mu.Unlock()
+
+	if watcher != nil {
+		watchConfigFiles(watcher, oldFiles, files)
+	}
 	return nil
 }
 
+// defaultConfig returns the default gitleaks configuration
+func defaultConfig() (config.Config, error) {
+	vc, err := parseViperConfig(config.DefaultConfig)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("reading default config: %w", err)
+	}
+	return translateConfig(vc)
+}
+
+// unmarshalConfig decodes the configuration read by v
+func unmarshalConfig(v *viper.Viper) (config.ViperConfig, error) {
+	var vc config.ViperConfig
+	if err := v.Unmarshal(&vc); err != nil {
+		return config.ViperConfig{}, fmt.Errorf("unmarshaling config: %w", err)
+	}
+	return vc, nil
+}
+
+// translateConfig converts a decoded configuration into a gitleaks config.
+// Errors in a rule are returned as *ruleError.
+func translateConfig(vc config.ViperConfig) (config.Config, error) {
+	if err := validatePatterns(vc); err != nil {
+		return config.Config{}, err
+	}
+
+	cfg, err := vc.Translate()
+	if err != nil {
+		// gitleaks prefixes errors in a rule with its ID
+		for _, rule := range vc.Rules {
+			if rule.ID != "" && strings.HasPrefix(err.Error(), rule.ID+": ") {
+				return config.Config{}, &ruleError{ruleID: rule.ID, err: err}
+			}
+		}
+		return config.Config{}, fmt.Errorf("translating config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ValidateConfigFile reads the config at path and the configs it extends
+// without falling back to the defaults, returning the error that load
+// would only log
+func ValidateConfigFile(path string) (config.Config, error) {
+	cfg, _, err := readConfigChain(path)
+	return cfg, err
+}
+
+// ValidateConfigTOML is ValidateConfigFile for the content of a config,
+// as given by GITLEAKS_CONFIG_TOML
+func ValidateConfigTOML(content string) (config.Config, error) {
+	cfg, _, err := readConfigContent(content)
+	return cfg, err
+}
+
+// Err returns why the config could not be loaded, or nil. The defaults
+// are used while there is an error.
+func (c *Config) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
+
+// Files returns the config file and the files it extends, which are
+// watched for changes
+func (c *Config) Files() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.files)
+}
+
 // GetConfig returns the current gitleaks config
 func (c *Config) GetConfig() config.Config {
 	c.mu.RLock()
@@ -94,22 +299,47 @@ func (c *Config) GetConfig() config.Config {
 	return c.cfg
 }
 
-// Watch starts watching the config file for changes
-func (c *Config) Watch(ctx context.Context) error {
-	if c.path == "" {
-		return nil // Nothing to watch
+// BaselinePath returns the baseline report to use: the baselinePath
+// setting resolved against the workspace root, or else a conventionally
+// named report in the root. Returns "" if there is none.
+func (c *Config) BaselinePath() string {
+	if path := c.settings.BaselinePath(); path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.rootPath, path)
+		}
+		return path
 	}
 
+	if c.rootPath == "" {
+		return ""
+	}
+	for _, name := range baselineNames {
+		path := filepath.Join(c.rootPath, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Watch starts watching the config file and the files it extends for
+// changes, including files that a later load or Refresh resolves. While the
+// defaults are used, a config created in one of the configNames locations
+// of the workspace root is loaded; when the config file is removed, it is
+// resolved again.
+func (c *Config) Watch(ctx context.Context) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("creating watcher: %w", err)
 	}
+
+	c.mu.Lock()
 	c.watcher = watcher
+	files := c.files
+	c.mu.Unlock()
 
-	dir := filepath.Dir(c.path)
-	if err := watcher.Add(dir); err != nil {
-		return fmt.Errorf("watching directory %s: %w", dir, err)
-	}
+	watchConfigFiles(watcher, nil, files)
+	c.watchCandidates(watcher)
 
 	go func() {
 		defer watcher.Close()
@@ -119,9 +349,23 @@ func (c *Config) Watch(ctx context.Context) error {
 				if !ok {
 					return
 				}
-				if event.Name == c.path {
-					if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-						slog.Info("config file changed", "path", c.path)
+				if event.Name == c.Path() && c.resolved && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					// The config is gone: resolve it again, falling back to
+					// the next location or the defaults
+					slog.Info("config file removed", "path", event.Name)
+					changed, err := c.Refresh()
+					if err == nil && !changed {
+						err = c.load()
+					}
+					c.watchCandidates(watcher)
+					if err != nil {
+						slog.Error("failed to reload config", "error", err)
+					} else if c.onReload != nil {
+						c.onReload()
+					}
+				} else if slices.Contains(c.Files(), event.Name) {
+					if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+						slog.Info("config file changed", "path", event.Name)
 						if err := c.load(); err != nil {
 							slog.Error("failed to reload config", "error", err)
 						} else {
@@ -130,6 +374,15 @@ func (c *Config) Watch(ctx context.Context) error {
 							}
 						}
 					}
+				} else if event.Op&fsnotify.Create != 0 && c.candidate(event.Name) {
+					// A new .gitleaks directory is watched before looking
+					// for a config in it, so that none is missed
+					c.watchCandidates(watcher)
+					if changed, err := c.Refresh(); err != nil {
+						slog.Error("failed to load created config", "path", event.Name, "error", err)
+					} else if changed && c.onReload != nil {
+						c.onReload()
+					}
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -144,3 +397,57 @@ func (c *Config) Watch(ctx context.Context) error {
 
 	return nil
 }
+
+// candidate reports whether path is one of configNames in the workspace
+// root, or a directory containing one, while the defaults are used
+func (c *Config) candidate(path string) bool {
+	if !c.resolved || c.rootPath == "" || c.Source() != ConfigSourceDefault {
+		return false
+	}
+	rel, err := filepath.Rel(c.rootPath, path)
+	if err != nil {
+		return false
+	}
+	for _, name := range configNames {
+		if rel == name || (rel == filepath.Dir(name) && rel != ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchCandidates watches the directories of configNames in the workspace
+// root while the defaults are used. Directories that do not exist yet are
+// added by the watcher once they are created.
+func (c *Config) watchCandidates(watcher *fsnotify.Watcher) {
+	if !c.resolved || c.rootPath == "" || c.Source() != ConfigSourceDefault {
+		return
+	}
+	for _, name := range configNames {
+		dir := filepath.Dir(filepath.Join(c.rootPath, name))
+		if err := watcher.Add(dir); err != nil {
+			slog.Debug("failed to watch config directory", "dir", dir, "error", err)
+		}
+	}
+}
+
+// watchConfigFiles moves watcher from the directories of the files in old
+// to those of the files in current. Directories that do not exist are
+// skipped; the files in them are reported as missing by load.
+func watchConfigFiles(watcher *fsnotify.Watcher, old, current []string) {
+	dirs := make(map[string]bool)
+	for _, file := range current {
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for _, file := range old {
+		if dir := filepath.Dir(file); !dirs[dir] {
+			_ = watcher.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			slog.Debug("failed to watch config directory", "dir", dir, "error", err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestConfig_BaselinePath(t *testing.T) {
+	root := t.TempDir()
+	settings := NewServerSettings()
+	cfg, err := NewConfig(root, settings, nil)
+	require.NoError(t, err)
+
+	// No baseline by default
+	assert.Empty(t, cfg.BaselinePath())
+
+	// A conventionally named report in the root is discovered
+	conventional := filepath.Join(root, "gitleaks-baseline.json")
+	require.NoError(t, os.WriteFile(conventional, []byte("[]"), 0644))
+	assert.Equal(t, conventional, cfg.BaselinePath())
+
+	// The setting wins and is resolved against the root
+	settings.UpdateSection(map[string]interface{}{"baselinePath": "ci/baseline.json"})
+	assert.Equal(t, filepath.Join(root, "ci", "baseline.json"), cfg.BaselinePath())
+
+	absolute := filepath.Join(t.TempDir(), "report.json")
+	settings.UpdateSection(map[string]interface{}{"baselinePath": absolute})
+	assert.Equal(t, absolute, cfg.BaselinePath())
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gitleaks.toml")
+
+	require.NoError(t, os.WriteFile(path, []byte("[[rules]]\nid = \"custom\"\nregex = '''custom_[a-z]+'''\n"), 0644))
+	cfg, err := ValidateConfigFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, cfg.Rules, "custom")
+	assert.Equal(t, path, cfg.Path)
+
+	// load would fall back to the defaults here
+	require.NoError(t, os.WriteFile(path, []byte("[[rules]\n"), 0644))
+	_, err = ValidateConfigFile(path)
+	assert.Error(t, err)
+}
+
+func TestResolveConfig(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	root := t.TempDir()
+	settings := NewServerSettings()
+
+	resolve := func() (string, ConfigSource) {
+		path, _, source := resolveConfig(root, settings)
+		return path, source
+	}
+
+	path, source := resolve()
+	assert.Empty(t, path)
+	assert.Equal(t, ConfigSourceDefault, source)
+
+	// In-repo locations, .gitleaks.toml first
+	nested := filepath.Join(root, ".gitleaks", "config.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(nested), 0755))
+	require.NoError(t, os.WriteFile(nested, []byte("[extend]\nuseDefault = true\n"), 0644))
+	path, source = resolve()
+	assert.Equal(t, nested, path)
+	assert.Equal(t, ConfigSourceWorkspace, source)
+
+	rootConfig := filepath.Join(root, ".gitleaks.toml")
+	require.NoError(t, os.WriteFile(rootConfig, []byte("[extend]\nuseDefault = true\n"), 0644))
+	path, _ = resolve()
+	assert.Equal(t, rootConfig, path)
+
+	// The environment overrides the workspace, GITLEAKS_CONFIG first
+	t.Setenv("GITLEAKS_CONFIG_TOML", "[extend]\nuseDefault = true\n")
+	path, toml, source := resolveConfig(root, settings)
+	assert.Empty(t, path)
+	assert.Equal(t, "[extend]\nuseDefault = true\n", toml)
+	assert.Equal(t, ConfigSourceEnvTOML, source)
+
+	orgConfig := filepath.Join(t.TempDir(), "org.toml")
+	t.Setenv("GITLEAKS_CONFIG", orgConfig)
+	path, source = resolve()
+	assert.Equal(t, orgConfig, path)
+	assert.Equal(t, ConfigSourceEnv, source)
+
+	// The setting overrides everything and is resolved against the root
+	settings.UpdateSection(map[string]interface{}{"configPath": "ci/gitleaks.toml"})
+	path, source = resolve()
+	assert.Equal(t, filepath.Join(root, "ci", "gitleaks.toml"), path)
+	assert.Equal(t, ConfigSourceSetting, source)
+}
+
+func TestConfig_Refresh(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	root := t.TempDir()
+	settings := NewServerSettings()
+	cfg, err := NewConfig(root, settings, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ConfigSourceDefault, cfg.Source())
+
+	changed, err := cfg.Refresh()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	orgConfig := filepath.Join(t.TempDir(), "org.toml")
+	require.NoError(t, os.WriteFile(orgConfig, []byte("[[rules]]\nid = \"org\"\nregex = '''org_[a-z]+'''\n"), 0644))
+	settings.UpdateSection(map[string]interface{}{"configPath": orgConfig})
+
+	changed, err = cfg.Refresh()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, orgConfig, cfg.Path())
+	assert.Equal(t, ConfigSourceSetting, cfg.Source())
+	assert.Contains(t, cfg.GetConfig().Rules, "org")
+}
+
+func TestConfig_WatchCreated(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	// A config created in any of the locations is loaded, including one in
+	// a directory that did not exist when watching started
+	for _, name := range configNames {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			reloaded := make(chan struct{}, 1)
+			cfg, err := NewConfig(root, NewServerSettings(), func() { reloaded <- struct{}{} })
+			require.NoError(t, err)
+			require.Equal(t, ConfigSourceDefault, cfg.Source())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			require.NoError(t, cfg.Watch(ctx))
+
+			path := filepath.Join(root, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte("[[rules]]\nid = \"org\"\nregex = '''org_[a-z]+'''\n"), 0644))
+
+			select {
+			case <-reloaded:
+			case <-time.After(5 * time.Second):
+				t.Fatal("config was not loaded")
+			}
+			assert.Equal(t, path, cfg.Path())
+			assert.Equal(t, ConfigSourceWorkspace, cfg.Source())
+			assert.Contains(t, cfg.GetConfig().Rules, "org")
+		})
+	}
+}
+
+func TestConfig_WatchRemoved(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	root := t.TempDir()
+	rootConfig := filepath.Join(root, configNames[0])
+	dirConfig := filepath.Join(root, configNames[1])
+	rule := func(id string) []byte {
+		return []byte("[[rules]]\nid = \"" + id + "\"\nregex = '''" + id + "_[a-z]+'''\n")
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(dirConfig), 0755))
+	require.NoError(t, os.WriteFile(rootConfig, rule("root"), 0644))
+	require.NoError(t, os.WriteFile(dirConfig, rule("dir"), 0644))
+
+	reloaded := make(chan struct{}, 10)
+	cfg, err := NewConfig(root, NewServerSettings(), func() { reloaded <- struct{}{} })
+	require.NoError(t, err)
+	require.Equal(t, rootConfig, cfg.Path())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, cfg.Watch(ctx))
+
+	waitFor := func(path string, source ConfigSource) {
+		t.Helper()
+		select {
+		case <-reloaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("config was not reloaded")
+		}
+		assert.Equal(t, path, cfg.Path())
+		assert.Equal(t, source, cfg.Source())
+		assert.NoError(t, cfg.Err(), "a removed config is not reported as broken")
+	}
+
+	// Removing the config falls back to the next location, then the defaults
+	require.NoError(t, os.Remove(rootConfig))
+	waitFor(dirConfig, ConfigSourceWorkspace)
+	assert.Contains(t, cfg.GetConfig().Rules, "dir")
+
+	require.NoError(t, os.Remove(dirConfig))
+	waitFor("", ConfigSourceDefault)
+	assert.NotContains(t, cfg.GetConfig().Rules, "dir")
+
+	// A config created afterwards is picked up again
+	require.NoError(t, os.WriteFile(rootConfig, rule("root"), 0644))
+	waitFor(rootConfig, ConfigSourceWorkspace)
+	assert.Contains(t, cfg.GetConfig().Rules, "root")
+}
+
+func TestConfig_EnvTOML(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "[[rules]]\nid = \"env\"\nregex = '''env_[a-z]+'''\n")
+
+	cfg, err := NewConfig(t.TempDir(), NewServerSettings(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Path())
+	assert.Equal(t, ConfigSourceEnvTOML, cfg.Source())
+	assert.Contains(t, cfg.GetConfig().Rules, "env")
+}
+
+func TestExecuteCommand_ServerInfo(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	root := t.TempDir()
+	configPath := filepath.Join(root, ".gitleaks", "config.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configPath), 0755))
+	require.NoError(t, os.WriteFile(configPath, []byte("[extend]\nuseDefault = true\n"), 0644))
+
+	s := newMultiRootServer(t, &glsp.Context{Notify: func(string, any) {}}, root)
+
+	result, err := s.executeCommand(&glsp.Context{}, &protocol.ExecuteCommandParams{Command: "gitleaks.serverInfo"})
+	require.NoError(t, err)
+
+	info := result.(map[string]any)
+	assert.Equal(t, lsName, info["name"])
+	folders := info["folders"].([]map[string]any)
+	require.Len(t, folders, 1)
+	assert.Equal(t, root, folders[0]["root"])
+	assert.Equal(t, configPath, folders[0]["config"])
+	assert.Equal(t, ConfigSourceWorkspace, folders[0]["configSource"])
+}
+
+func TestLogConfigSources(t *testing.T) {
+	t.Setenv("GITLEAKS_CONFIG", "")
+	t.Setenv("GITLEAKS_CONFIG_TOML", "")
+
+	var mu sync.Mutex
+	var messages []string
+	ctx := &glsp.Context{Notify: func(method string, params any) {
+		if p, ok := params.(protocol.LogMessageParams); ok && method == protocol.ServerWindowLogMessage {
+			mu.Lock()
+			messages = append(messages, p.Message)
+			mu.Unlock()
+		}
+	}}
+	logged := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(messages)
+	}
+
+	root := t.TempDir()
+	s := newMultiRootServer(t, ctx, root)
+	require.NoError(t, s.initialized(ctx, &protocol.InitializedParams{}))
+	require.Len(t, logged(), 1)
+	assert.Contains(t, logged()[0], "source: default")
+
+	// An unchanged source is not logged again
+	s.republishDiagnostics(ctx)
+	assert.Len(t, logged(), 1)
+
+	// A reload reports the new config
+	configPath := filepath.Join(root, ".gitleaks.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte("[extend]\nuseDefault = true\n"), 0644))
+	assert.Eventually(t, func() bool { return len(logged()) == 2 }, 5*time.Second, 20*time.Millisecond)
+	assert.Contains(t, logged()[len(logged())-1], configPath+" (source: workspace)")
+}
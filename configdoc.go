@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+// configKey documents a key or table of a gitleaks config
+type configKey struct {
+	name   string
+	detail string
+	doc    string
+}
+
+// allowlistKeys are the keys of [[rules.allowlists]] and [[allowlists]]
+var allowlistKeys = []configKey{
+	{"description", "string", "Why the allowlist exists."},
+	{"condition", "string", "How the criteria combine: `\"OR\"` (default) ignores a finding that matches any of them, `\"AND\"` only one that matches all."},
+	{"commits", "array of strings", "Commit SHAs whose findings are ignored."},
+	{"paths", "array of regexes", "Regexes of file paths whose findings are ignored."},
+	{"regexTarget", "string", "What `regexes` are matched against: `\"secret\"` (default), `\"match\"` or `\"line\"`."},
+	{"regexes", "array of regexes", "Regexes of secrets that are ignored."},
+	{"stopWords", "array of strings", "Findings whose secret contains one of these words are ignored."},
+}
+
+// configTableKeys lists the keys of each table of a gitleaks config. ""
+// is the top level.
+var configTableKeys = map[string][]configKey{
+	"": {
+		{"title", "string", "Name of the config."},
+		{"description", "string", "Description of the config."},
+		{"minVersion", "string", "Oldest gitleaks version the config works with, such as `\"v8.25.0\"`."},
+	},
+	"extend": {
+		{"path", "string", "Config to extend, relative to this file. Its rules and allowlists are added to this config."},
+		{"useDefault", "boolean", "Extend the default gitleaks config. Cannot be combined with `path`."},
+		{"disabledRules", "array of strings", "IDs of extended rules to leave out."},
+	},
+	"rules": {
+		{"id", "string", "Unique identifier of the rule. A rule with the ID of an extended rule overrides the fields it sets."},
+		{"description", "string", "Human readable description of the secret the rule detects."},
+		{"regex", "regex", "Go regular expression that matches the secret."},
+		{"secretGroup", "integer", "Capture group of `regex` that holds the secret. Defaults to the first non-empty group."},
+		{"entropy", "float", "Minimum Shannon entropy of the secret. Matches below it are not reported."},
+		{"path", "regex", "Go regular expression that the file path must match. A rule with only a path reports the file itself."},
+		{"keywords", "array of strings", "Words of which at least one must occur for `regex` to be checked. Matched case-insensitively; they make scanning fast."},
+		{"tags", "array of strings", "Tags reported with the findings of the rule."},
+		{"skipReport", "boolean", "Never report findings of the rule; it is only used by the `[[rules.required]]` of others."},
+	},
+	"rules.allowlists": allowlistKeys,
+	"rules.required": {
+		{"id", "string", "ID of a rule that must also match near the finding for it to be reported."},
+		{"withinLines", "integer", "How many lines away the required rule may match."},
+		{"withinColumns", "integer", "How many columns away the required rule may match."},
+	},
+	"allowlists": append(slices.Clone(allowlistKeys),
+		configKey{"targetRules", "array of strings", "IDs of the rules the allowlist applies to. It applies to all rules if empty."}),
+}
+
+// configTables are the tables a gitleaks config can have
+var configTables = []configKey{
+	{"[extend]", "table", "Extends another config, such as the gitleaks defaults, with this one."},
+	{"[[rules]]", "array of tables", "A rule that detects a kind of secret."},
+	{"[[rules.allowlists]]", "array of tables", "Findings of the rule above that are not reported."},
+	{"[[rules.required]]", "array of tables", "Another rule that must match near findings of the rule above for them to be reported."},
+	{"[[allowlists]]", "array of tables", "Findings of any rule, or of `targetRules`, that are not reported."},
+}
+
+var (
+	tomlHeaderPattern = regexp.MustCompile(`^\s*\[\[?\s*([A-Za-z0-9_.-]+)\s*\]\]?`)
+	tomlKeyPattern    = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+)
+
+// tomlLine is a line of a config as far as its editing features need it
+type tomlLine struct {
+	offset   int    // of the line in the content
+	table    string // the table the line is in, such as "rules.allowlists"
+	header   string // the table header on the line, if any
+	key      string // the key assigned on the line, if any
+	keyStart int    // byte column of key
+	value    string // the text after '='
+}
+
+// parseTOMLLines splits a config into lines and tracks the table each is in.
+// Lines of multi-line strings are never headers or keys.
+func parseTOMLLines(content string) []tomlLine {
+	var (
+		lines     []tomlLine
+		table     string
+		multiline string // the open multi-line string delimiter
+		offset    int
+	)
+	for text := range strings.SplitSeq(content, "\n") {
+		line := tomlLine{offset: offset, table: table}
+		offset += len(text) + 1
+
+		if multiline != "" {
+			if strings.Count(text, multiline)%2 == 1 {
+				multiline = ""
+			}
+			lines = append(lines, line)
+			continue
+		}
+
+		if m := tomlHeaderPattern.FindStringSubmatch(text); m != nil {
+			// The deprecated single allowlists have the same keys
+			table = m[1]
+			switch table {
+			case "allowlist":
+				table = "allowlists"
+			case "rules.allowlist":
+				table = "rules.allowlists"
+			}
+			line.table, line.header = table, strings.TrimSpace(m[0])
+		} else if m := tomlKeyPattern.FindStringSubmatchIndex(text); m != nil {
+			line.key, line.keyStart, line.value = text[m[4]:m[5]], m[4], text[m[6]:m[7]]
+		}
+
+		for _, delimiter := range []string{"'''", `"""`} {
+			if strings.Count(text, delimiter)%2 == 1 {
+				multiline = delimiter
+				break
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// tomlString returns the string a TOML value starts with
+func tomlString(value string) (string, bool) {
+	if len(value) < 2 || (value[0] != '"' && value[0] != '\'') {
+		return "", false
+	}
+	end := strings.IndexByte(value[1:], value[0])
+	if end < 0 {
+		return "", false
+	}
+	return value[1 : end+1], true
+}
+
+// isConfigDocument reports whether uri is a gitleaks config: a file with
+// the name of one, or a file of the chain of a loaded config
+func (s *Server) isConfigDocument(uri protocol.DocumentUri) bool {
+	path := uriToPath(uri)
+	for _, name := range configNames {
+		if strings.HasSuffix(path, string(filepath.Separator)+name) {
+			return true
+		}
+	}
+
+	for _, f := range s.getFolders() {
+		for _, c := range f.loadedConfigs() {
+			if slices.Contains(c.Files(), path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadedConfig returns the loaded config whose file is at path
+func (s *Server) loadedConfig(path string) (*Config, bool) {
+	for _, f := range s.getFolders() {
+		for _, c := range f.loadedConfigs() {
+			if c.Path() == path {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) textDocumentCompletion(context *glsp.Context, params *protocol.CompletionParams) (any, error) {
+	uri := params.TextDocument.URI
+	if !s.isConfigDocument(uri) {
+		return nil, nil
+	}
+	content, ok := s.documentContent(uri)
+	if !ok {
+		return nil, nil
+	}
+	return configCompletions(content, params.Position), nil
+}
+
+// configCompletions completes the table header or key at position in a
+// gitleaks config
+func configCompletions(content string, position protocol.Position) []protocol.CompletionItem {
+	lines := parseTOMLLines(content)
+	if int(position.Line) >= len(lines) {
+		return nil
+	}
+
+	text := strings.Split(content, "\n")[position.Line]
+	before := text[:min(int(position.Character), len(text))]
+	if strings.Contains(before, "=") {
+		return nil
+	}
+
+	// A line that is not a header takes the table of the line before it
+	table := lines[position.Line].table
+	if lines[position.Line].header != "" && position.Line > 0 {
+		table = lines[position.Line-1].table
+	}
+
+	start := len(before) - len(strings.TrimLeft(before, " \t"))
+	replace := protocol.Range{
+		Start: protocol.Position{Line: position.Line, Character: uint32(start)},
+		End:   position,
+	}
+	word := before[start:]
+
+	var items []protocol.CompletionItem
+	add := func(key configKey, kind protocol.CompletionItemKind, insert string) {
+		if !strings.HasPrefix(insert, word) {
+			return
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:         key.name,
+			Kind:          &kind,
+			Detail:        &key.detail,
+			Documentation: protocol.MarkupContent{Kind: protocol.MarkupKindMarkdown, Value: key.doc},
+			TextEdit:      protocol.TextEdit{Range: replace, NewText: insert},
+		})
+	}
+
+	if !strings.HasPrefix(word, "[") {
+		// Keys already set in this table are not offered again
+		set := make(map[string]bool)
+		for i := int(position.Line) - 1; i >= 0 && lines[i].header == ""; i-- {
+			set[lines[i].key] = true
+		}
+		for i := int(position.Line) + 1; i < len(lines) && lines[i].header == ""; i++ {
+			set[lines[i].key] = true
+		}
+
+		for _, key := range configTableKeys[table] {
+			if !set[key.name] {
+				add(key, protocol.CompletionItemKindProperty, key.name+" = ")
+			}
+		}
+	}
+	for _, header := range configTables {
+		add(header, protocol.CompletionItemKindModule, header.name)
+	}
+	return items
+}
+
+// configHover documents the table header or key at position in a
+// gitleaks config
+func configHover(content string, position protocol.Position) *protocol.Hover {
+	lines := parseTOMLLines(content)
+	if int(position.Line) >= len(lines) {
+		return nil
+	}
+	line := lines[position.Line]
+	character := int(position.Character)
+
+	var key configKey
+	var start, end int
+	switch {
+	case line.header != "":
+		i := slices.IndexFunc(configTables, func(k configKey) bool {
+			return strings.Trim(k.name, "[]") == line.table
+		})
+		if i < 0 {
+			return nil
+		}
+		key = configTables[i]
+		text := strings.Split(content, "\n")[position.Line]
+		start = strings.Index(text, "[")
+		end = start + len(line.header)
+
+	case line.key != "":
+		i := slices.IndexFunc(configTableKeys[line.table], func(k configKey) bool {
+			return k.name == line.key
+		})
+		if i < 0 {
+			return nil
+		}
+		key = configTableKeys[line.table][i]
+		start, end = line.keyStart, line.keyStart+len(line.key)
+
+	default:
+		return nil
+	}
+
+	if character < start || character > end {
+		return nil
+	}
+
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.MarkupKindMarkdown,
+			Value: fmt.Sprintf("**%s** — %s\n\n%s", key.name, key.detail, key.doc),
+		},
+		Range: &protocol.Range{
+			Start: protocol.Position{Line: position.Line, Character: uint32(start)},
+			End:   protocol.Position{Line: position.Line, Character: uint32(end)},
+		},
+	}
+}
+
+// lintConfigDocument checks the content of a gitleaks config as it is
+// edited: the error loading it with this content, rule IDs defined twice,
+// and disabledRules that name no extended rule
+func (s *Server) lintConfigDocument(uri protocol.DocumentUri, content string) []protocol.Diagnostic {
+	path := uriToPath(uri)
+	reader := chainReader{overlay: map[string]string{path: content}}
+
+	var diagnostics []protocol.Diagnostic
+	if _, _, err := reader.readConfigChain(path); err != nil {
+		diagnostics = append(diagnostics, s.configErrorDiagnostic(path, content, err))
+	}
+
+	lines := parseTOMLLines(content)
+	diagnostics = append(diagnostics, duplicateRuleDiagnostics(lines)...)
+
+	vc, err := parseViperConfig(content)
+	if err != nil {
+		return diagnostics // a syntax error, reported above
+	}
+	return append(diagnostics, disabledRuleDiagnostics(reader, path, content, lines, vc)...)
+}
+
+// duplicateRuleDiagnostics warns about rules whose ID is already used by
+// another rule of the same file, which it silently replaces
+func duplicateRuleDiagnostics(lines []tomlLine) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	seen := make(map[string]int)
+	for i, line := range lines {
+		if line.table != "rules" || line.key != "id" {
+			continue
+		}
+		id, ok := tomlString(line.value)
+		if !ok {
+			continue
+		}
+		if first, ok := seen[id]; ok {
+			diagnostics = append(diagnostics, configWarning(uint32(i), uint32(line.keyStart), uint32(len(line.key)),
+				fmt.Sprintf("rule %q is already defined on line %d", id, first+1)))
+			continue
+		}
+		seen[id] = i
+	}
+	return diagnostics
+}
+
+// disabledRuleDiagnostics warns about disabledRules that are not rules of
+// the config that vc, read from path, extends
+func disabledRuleDiagnostics(reader chainReader, path, content string, lines []tomlLine, vc config.ViperConfig) []protocol.Diagnostic {
+	if len(vc.Extend.DisabledRules) == 0 {
+		return nil
+	}
+
+	var base config.ViperConfig
+	switch {
+	case vc.Extend.UseDefault:
+		base, _ = parseViperConfig(config.DefaultConfig)
+	case vc.Extend.Path != "":
+		var err error
+		if base, _, err = reader.readViperChain(extendBasePath(path, vc.Extend.Path), []string{path}); err != nil {
+			return nil // reported by lintConfigDocument
+		}
+	}
+
+	ids := make(map[string]bool, len(base.Rules))
+	for _, rule := range base.Rules {
+		ids[rule.ID] = true
+	}
+
+	// Unknown IDs are placed on their string in the disabledRules array
+	i := slices.IndexFunc(lines, func(line tomlLine) bool {
+		return line.table == "extend" && line.key == "disabledRules"
+	})
+	if i < 0 {
+		return nil
+	}
+	keyOffset := lines[i].offset + lines[i].keyStart
+
+	var diagnostics []protocol.Diagnostic
+	for _, id := range vc.Extend.DisabledRules {
+		if ids[id] {
+			continue
+		}
+		line, column, width := uint32(i), uint32(lines[i].keyStart), uint32(len("disabledRules"))
+		for _, quote := range []string{`"`, "'"} {
+			if j := strings.Index(content[keyOffset:], quote+id+quote); j >= 0 {
+				line, column = offsetPosition(content, keyOffset+j)
+				width = uint32(len(id) + 2)
+				break
+			}
+		}
+		diagnostics = append(diagnostics, configWarning(line, column, width,
+			fmt.Sprintf("disabledRules: %q is not a rule of the extended config", id)))
+	}
+	return diagnostics
+}
+
+// configWarning is a warning about a gitleaks config at a 0-based line and
+// byte column
+func configWarning(line, column, width uint32, message string) protocol.Diagnostic {
+	severity := protocol.DiagnosticSeverityWarning
+	source := "gitleaks"
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: line, Character: column},
+			End:   protocol.Position{Line: line, Character: column + width},
+		},
+		Severity: &severity,
+		Source:   &source,
+		Message:  message,
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestParseTOMLLines(t *testing.T) {
+	content := "title = \"x\"\n[[rules]]\nid = \"a\"\nregex = '''\n[[not-a-table]]\n'''\n[rules.allowlist]\nregexes = []\n"
+	lines := parseTOMLLines(content)
+	require.Len(t, lines, 9)
+
+	assert.Equal(t, "", lines[0].table)
+	assert.Equal(t, "title", lines[0].key)
+	assert.Equal(t, "[[rules]]", lines[1].header)
+	assert.Equal(t, "rules", lines[2].table)
+	assert.Equal(t, "id", lines[2].key)
+	assert.Equal(t, `"a"`, lines[2].value)
+
+	// A multi-line string has no headers or keys
+	assert.Empty(t, lines[4].header)
+	assert.Equal(t, "rules", lines[5].table)
+
+	// The deprecated single allowlist has the keys of allowlists
+	assert.Equal(t, "rules.allowlists", lines[6].table)
+	assert.Equal(t, "regexes", lines[7].key)
+	assert.Equal(t, len("title = \"x\"\n"), lines[1].offset)
+}
+
+func completionLabels(items []protocol.CompletionItem) []string {
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func TestConfigCompletions(t *testing.T) {
+	content := "[extend]\nuseDefault = true\n\n[[rules]]\nid = \"custom\"\nre\n\n[[rules.allowlists]]\n\n[\n"
+
+	// Keys of the table, without those already set
+	labels := completionLabels(configCompletions(content, protocol.Position{Line: 2, Character: 0}))
+	assert.Contains(t, labels, "path")
+	assert.Contains(t, labels, "disabledRules")
+	assert.NotContains(t, labels, "useDefault")
+	assert.Contains(t, labels, "[[rules]]")
+
+	// Keys are filtered by what is typed and replace it
+	items := configCompletions(content, protocol.Position{Line: 5, Character: 2})
+	assert.Equal(t, []string{"regex"}, completionLabels(items))
+	edit, ok := items[0].TextEdit.(protocol.TextEdit)
+	require.True(t, ok)
+	assert.Equal(t, "regex = ", edit.NewText)
+	assert.Equal(t, protocol.Position{Line: 5, Character: 0}, edit.Range.Start)
+
+	labels = completionLabels(configCompletions(content, protocol.Position{Line: 8, Character: 0}))
+	assert.Contains(t, labels, "regexes")
+	assert.Contains(t, labels, "stopWords")
+	assert.NotContains(t, labels, "targetRules")
+
+	// After '[' only tables are offered
+	assert.Equal(t, []string{"[extend]", "[[rules]]", "[[rules.allowlists]]", "[[rules.required]]", "[[allowlists]]"},
+		completionLabels(configCompletions(content, protocol.Position{Line: 9, Character: 1})))
+
+	// Values are not completed
+	assert.Empty(t, configCompletions(content, protocol.Position{Line: 4, Character: 6}))
+}
+
+func TestConfigHover(t *testing.T) {
+	content := "[[rules]]\nid = \"custom\"\nsecretGroup = 1\n\n[[allowlists]]\ntargetRules = [\"custom\"]\n"
+
+	hover := configHover(content, protocol.Position{Line: 2, Character: 3})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.(protocol.MarkupContent).Value, "**secretGroup**")
+	assert.Equal(t, protocol.Position{Line: 2, Character: 11}, hover.Range.End)
+
+	hover = configHover(content, protocol.Position{Line: 0, Character: 4})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.(protocol.MarkupContent).Value, "A rule that detects")
+
+	hover = configHover(content, protocol.Position{Line: 5, Character: 0})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.(protocol.MarkupContent).Value, "IDs of the rules the allowlist applies to")
+
+	// Values have no docs
+	assert.Nil(t, configHover(content, protocol.Position{Line: 2, Character: 15}))
+}
+
+func TestLintConfigDocument(t *testing.T) {
+	root := t.TempDir()
+	writeConfig(t, filepath.Join(root, "base.toml"), "[[rules]]\nid = \"base-a\"\nregex = '''a'''\n\n[[rules]]\nid = \"base-b\"\nregex = '''b'''\n")
+	path := filepath.Join(root, ".gitleaks.toml")
+	writeConfig(t, path, "[extend]\npath = \"base.toml\"\n")
+
+	s := newMultiRootServer(t, &glsp.Context{Notify: func(string, any) {}}, root)
+	uri := pathToURI(path)
+
+	// The content being edited is checked, not the file on disk
+	content := "[extend]\npath = \"base.toml\"\ndisabledRules = [\"base-a\", \"nope\"]\n\n" +
+		"[[rules]]\nid = \"one\"\nregex = '''one'''\n\n[[rules]]\nid = \"one\"\nregex = '''one_[a-z'''\n"
+	diagnostics := s.lintConfigDocument(uri, content)
+	require.Len(t, diagnostics, 3)
+
+	assert.Equal(t, protocol.DiagnosticSeverityError, *diagnostics[0].Severity)
+	assert.Contains(t, diagnostics[0].Message, "one: invalid regex")
+	assert.Equal(t, protocol.Position{Line: 10, Character: 15}, diagnostics[0].Range.Start)
+	assert.NotContains(t, diagnostics[0].Message, "default rules")
+
+	assert.Equal(t, protocol.DiagnosticSeverityWarning, *diagnostics[1].Severity)
+	assert.Contains(t, diagnostics[1].Message, `rule "one" is already defined on line 6`)
+	assert.Equal(t, protocol.Position{Line: 9, Character: 0}, diagnostics[1].Range.Start)
+
+	assert.Contains(t, diagnostics[2].Message, `"nope" is not a rule of the extended config`)
+	assert.Equal(t, protocol.Range{
+		Start: protocol.Position{Line: 2, Character: 27},
+		End:   protocol.Position{Line: 2, Character: 33},
+	}, diagnostics[2].Range)
+
+	// The default rules are known to useDefault
+	assert.Empty(t, s.lintConfigDocument(uri, "[extend]\nuseDefault = true\ndisabledRules = [\"aws-access-token\"]\n"))
+}
+
+func TestIntegration_ConfigDocument(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, ".gitleaks.toml")
+	writeConfig(t, path, "[extend]\nuseDefault = true\n")
+
+	var published []protocol.PublishDiagnosticsParams
+	ctx := &glsp.Context{
+		Notify: func(method string, params any) {
+			if p, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				published = append(published, p)
+			}
+		},
+	}
+	s := newMultiRootServer(t, ctx, root)
+
+	uri := pathToURI(path)
+	require.NoError(t, s.textDocumentDidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "toml", Version: 1, Text: "[extend]\nuseDefault = true\n\n[[rules]]\nid = \"x\"\nregex = '''(x'''\n"},
+	}))
+	require.NotEmpty(t, published)
+	diagnostics := published[len(published)-1].Diagnostics
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, uint32(5), diagnostics[0].Range.Start.Line)
+
+	result, err := s.textDocumentCompletion(ctx, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 6, Character: 0},
+		},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, completionLabels(result.([]protocol.CompletionItem)), "secretGroup")
+
+	hover, err := s.textDocumentHover(ctx, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+
+	// Other documents are left alone
+	result, err = s.textDocumentCompletion(ctx, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, "main.go"))},
+		},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
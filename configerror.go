@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+// configError is an error in one of the files of a config chain, at a
+// 0-based line and byte column of that file
+type configError struct {
+	path   string
+	line   uint32
+	column uint32
+	width  uint32 // of the text at fault, 0 for the rest of the line
+	err    error
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.path, e.line+1, e.column+1, e.err)
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// ruleError is an error in a rule of a config, or in a global allowlist if
+// ruleID is "". pattern is the regex that does not compile, if any.
+type ruleError struct {
+	ruleID  string
+	pattern string
+	err     error
+}
+
+func (e *ruleError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ruleError) Unwrap() error {
+	return e.err
+}
+
+// readError returns an error reading the config file at path, placed at
+// the position of a TOML syntax error
+func readError(path string, err error) error {
+	e := &configError{path: path, err: err}
+
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		row, column := decodeErr.Position()
+		e.line, e.column = uint32(max(0, row-1)), uint32(max(0, column-1))
+		e.err = decodeErr
+	}
+	return e
+}
+
+// extendError returns an error in the [extend] table of the config file
+// at path, placed on its path key
+func (r chainReader) extendError(path string, err error) error {
+	if path == "" {
+		return err
+	}
+
+	e := &configError{path: path, err: err}
+	if content, readErr := r.readFile(path); readErr == nil {
+		e.line = extendPathLine(string(content))
+	}
+	return e
+}
+
+// validatePatterns compiles the regexes of vc. gitleaks compiles them with
+// regexp.MustCompile, so a config with a broken regex would panic.
+func validatePatterns(vc config.ViperConfig) error {
+	check := func(ruleID string, patterns ...string) error {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				continue
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				if ruleID == "" {
+					err = fmt.Errorf("[[allowlists]] invalid regex: %w", err)
+				} else {
+					err = fmt.Errorf("%s: invalid regex: %w", ruleID, err)
+				}
+				return &ruleError{ruleID: ruleID, pattern: pattern, err: err}
+			}
+		}
+		return nil
+	}
+
+	for _, rule := range vc.Rules {
+		if err := check(rule.ID, rule.Regex, rule.Path); err != nil {
+			return err
+		}
+
+		allowlists := slices.Clone(rule.Allowlists)
+		if rule.AllowList != nil {
+			allowlists = append(allowlists, rule.AllowList)
+		}
+		for _, a := range allowlists {
+			if err := check(rule.ID, slices.Concat(a.Regexes, a.Paths)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	allowlists := slices.Clone(vc.Allowlists)
+	if vc.AllowList != nil {
+		allowlists = append(allowlists, vc.AllowList)
+	}
+	for _, a := range allowlists {
+		if err := check("", slices.Concat(a.Regexes, a.Paths)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// locateConfigError places an error from translating the config chain of
+// files in the file and at the position of the rule or regex at fault. The
+// error stays in the first file if neither is found.
+func (r chainReader) locateConfigError(err error, files []string) error {
+	var ce *configError
+	if err == nil || len(files) == 0 || errors.As(err, &ce) {
+		return err
+	}
+
+	var re *ruleError
+	if errors.As(err, &re) {
+		for _, path := range files {
+			content, readErr := r.readFile(path)
+			if readErr != nil {
+				continue
+			}
+			if line, column, width, ok := findRuleError(string(content), re); ok {
+				return &configError{path: path, line: line, column: column, width: width, err: err}
+			}
+		}
+	}
+	return &configError{path: files[0], err: err}
+}
+
+// findRuleError finds the regex of re in the content of a config file, or
+// else the ID of its rule
+func findRuleError(content string, re *ruleError) (line, column, width uint32, ok bool) {
+	if re.pattern != "" {
+		if i := strings.Index(content, re.pattern); i >= 0 {
+			// Point at the part of the regex that does not parse
+			offset, length := 0, len(re.pattern)
+			var syntaxErr *syntax.Error
+			if errors.As(re.err, &syntaxErr) && syntaxErr.Expr != "" {
+				if j := strings.Index(re.pattern, syntaxErr.Expr); j >= 0 {
+					offset, length = j, len(syntaxErr.Expr)
+				}
+			}
+			line, column := offsetPosition(content, i+offset)
+			return line, column, uint32(length), true
+		}
+	}
+
+	if re.ruleID != "" {
+		pattern := regexp.MustCompile(`(?m)^\s*id\s*=\s*["']` + regexp.QuoteMeta(re.ruleID) + `["']`)
+		if loc := pattern.FindStringIndex(content); loc != nil {
+			start := loc[0] + strings.Index(content[loc[0]:loc[1]], "id")
+			line, column := offsetPosition(content, start)
+			return line, column, uint32(loc[1] - start), true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// offsetPosition converts a byte offset in content to a 0-based line and
+// byte column
+func offsetPosition(content string, offset int) (line, column uint32) {
+	before := content[:offset]
+	lineStart := strings.LastIndex(before, "\n") + 1
+	return uint32(strings.Count(before, "\n")), uint32(offset - lineStart)
+}
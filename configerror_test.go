@@ -0,0 +1,161 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestReadConfigChain_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    uint32
+		column  uint32
+		width   uint32
+		message string
+	}{
+		{
+			name:    "toml syntax",
+			content: "title = \"x\"\n[[rules]\nid = \"broken\"\n",
+			line:    1,
+			column:  8,
+			message: "toml:",
+		},
+		{
+			name:    "regex",
+			content: "[[rules]]\nid = \"bad\"\nregex = '''token_[a-z'''\n",
+			line:    2,
+			column:  17,
+			width:   4,
+			message: "bad: invalid regex",
+		},
+		{
+			name:    "escaped regex",
+			content: "[[rules]]\nid = \"bad\"\nregex = \"\\\\d{2}\\\\w(\"\n",
+			line:    1,
+			column:  0,
+			width:   10,
+			message: "bad: invalid regex",
+		},
+		{
+			name:    "allowlist regex",
+			content: "[[rules]]\nid = \"ok\"\nregex = '''ok'''\n\n[[allowlists]]\npaths = ['''vendor/(''']\n",
+			line:    5,
+			column:  12,
+			width:   8,
+			message: "[[allowlists]] invalid regex",
+		},
+		{
+			name:    "rule",
+			content: "[[rules]]\nid = \"parent\"\nregex = '''p'''\n[[rules.required]]\nid = \"missing\"\n",
+			line:    1,
+			column:  0,
+			width:   13,
+			message: "rule ID 'missing' does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".gitleaks.toml")
+			writeConfig(t, path, tt.content)
+
+			_, _, err := readConfigChain(path)
+			var ce *configError
+			require.ErrorAs(t, err, &ce)
+			assert.Equal(t, path, ce.path)
+			assert.Equal(t, tt.line, ce.line)
+			assert.Equal(t, tt.column, ce.column)
+			assert.Equal(t, tt.width, ce.width)
+			assert.Contains(t, ce.err.Error(), tt.message)
+		})
+	}
+}
+
+func TestReadConfigChain_ErrorInBase(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.toml")
+	writeConfig(t, base, "[[rules]]\nid = \"bad\"\nregex = '''(x'''\n")
+	writeConfig(t, filepath.Join(dir, ".gitleaks.toml"), "[extend]\npath = \"base.toml\"\n")
+
+	_, _, err := readConfigChain(filepath.Join(dir, ".gitleaks.toml"))
+	var ce *configError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, base, ce.path)
+	assert.Equal(t, uint32(2), ce.line)
+}
+
+func TestIntegration_InvalidConfig(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		published = make(map[protocol.DocumentUri][]protocol.Diagnostic)
+		messages  []protocol.ShowMessageParams
+	)
+	ctx := &glsp.Context{
+		Notify: func(method string, params any) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch p := params.(type) {
+			case protocol.PublishDiagnosticsParams:
+				published[p.URI] = p.Diagnostics
+			case protocol.ShowMessageParams:
+				messages = append(messages, p)
+			}
+		},
+	}
+	lastDiagnostics := func(uri protocol.DocumentUri) []protocol.Diagnostic {
+		mu.Lock()
+		defer mu.Unlock()
+		return published[uri]
+	}
+	shownMessages := func() []protocol.ShowMessageParams {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(messages)
+	}
+
+	root := t.TempDir()
+	configPath := filepath.Join(root, ".gitleaks.toml")
+	configURI := pathToURI(configPath)
+	writeConfig(t, configPath, "[[rules]]\nid = \"custom\"\nregex = '''custom_[a-z'''\n")
+
+	s := newMultiRootServer(t, ctx, root)
+	require.NoError(t, s.initialized(ctx, &protocol.InitializedParams{}))
+
+	// The regex is reported where it is, and the fallback is announced
+	diagnostics := lastDiagnostics(configURI)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, protocol.Position{Line: 2, Character: 18}, diagnostics[0].Range.Start)
+	assert.Equal(t, protocol.Position{Line: 2, Character: 22}, diagnostics[0].Range.End)
+	assert.Contains(t, diagnostics[0].Message, "custom: invalid regex")
+	assert.Contains(t, diagnostics[0].Message, "default rules")
+
+	shown := shownMessages()
+	require.Len(t, shown, 1)
+	assert.Equal(t, protocol.MessageTypeWarning, shown[0].Type)
+	assert.Contains(t, shown[0].Message, configPath)
+
+	// Republishing does not repeat the warning
+	s.republishDiagnostics(ctx)
+	assert.Len(t, shownMessages(), 1)
+
+	// Fixing the config clears the diagnostic
+	writeConfig(t, configPath, "[[rules]]\nid = \"custom\"\nregex = '''custom_[a-z]{8}'''\n")
+	assert.Eventually(t, func() bool {
+		return len(lastDiagnostics(configURI)) == 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Breaking it again warns again
+	writeConfig(t, configPath, "[[rules]\n")
+	assert.Eventually(t, func() bool {
+		return len(shownMessages()) == 2 && len(lastDiagnostics(configURI)) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
@@ -29,18 +31,153 @@ func adjustColumn(col int, lineNum int, isEndColumn bool) uint32 {
 	return uint32(max(0, col-2))
 }
 
-// FindingsToDiagnostics converts scanner findings to LSP diagnostics
-func FindingsToDiagnostics(findings []Finding) []protocol.Diagnostic {
+// FindingsToDiagnostics converts scanner findings to LSP diagnostics of the
+// given severity
+func FindingsToDiagnostics(findings []Finding, severity protocol.DiagnosticSeverity) []protocol.Diagnostic {
 	diagnostics := make([]protocol.Diagnostic, 0, len(findings))
 	for _, f := range findings {
-		diagnostics = append(diagnostics, FindingToDiagnostic(f))
+		diagnostics = append(diagnostics, FindingToDiagnostic(f, severity))
 	}
 	return diagnostics
 }
 
+// diagnostics converts findings to diagnostics with the severity from the
+// server's settings
+func (s *Server) diagnostics(findings []Finding) []protocol.Diagnostic {
+	return FindingsToDiagnostics(findings, s.settings.DiagnosticSeverity())
+}
+
+// documentDiagnostics returns the diagnostics of a scanned document: its
+// findings and, for a gitleaks config, the problems with its content
+func (s *Server) documentDiagnostics(uri protocol.DocumentUri, content string, findings []Finding) []protocol.Diagnostic {
+	diagnostics := s.diagnostics(findings)
+	if s.isConfigDocument(uri) {
+		diagnostics = append(diagnostics, s.lintConfigDocument(uri, content)...)
+	}
+	return diagnostics
+}
+
+// configDiagnostics returns the problem loading the gitleaks config at
+// uri, see configErrorDiagnostic. Other documents have none.
+func (s *Server) configDiagnostics(uri protocol.DocumentUri) []protocol.Diagnostic {
+	path := uriToPath(uri)
+	c, ok := s.loadedConfig(path)
+	if !ok || c.Err() == nil {
+		return nil
+	}
+
+	content, _ := s.documentContent(uri)
+	return []protocol.Diagnostic{s.configErrorDiagnostic(path, content, c.Err())}
+}
+
+// configErrorDiagnostic reports err, from loading the config at path with
+// content, where it is in the file. An error in a file the config extends
+// is reported on its [extend] path.
+func (s *Server) configErrorDiagnostic(path, content string, err error) protocol.Diagnostic {
+	var (
+		line, column, width uint32
+		message             = err.Error()
+		ce                  *configError
+	)
+	if errors.As(err, &ce) && ce.path == path {
+		line, column, width, message = ce.line, ce.column, ce.width, ce.err.Error()
+	} else {
+		line = extendPathLine(content)
+	}
+
+	end := protocol.Position{Line: line + 1}
+	if width > 0 {
+		end = protocol.Position{Line: line, Character: column + width}
+	}
+
+	// Say so if the folder is scanned with the defaults because of it
+	if c, ok := s.loadedConfig(path); ok && c.Err() != nil {
+		message += " (using the default rules)"
+	}
+
+	severity := protocol.DiagnosticSeverityError
+	source := "gitleaks"
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: line, Character: column},
+			End:   end,
+		},
+		Severity: &severity,
+		Source:   &source,
+		Message:  message,
+	}
+}
+
+// publishConfigDiagnostics publishes the problems of the gitleaks configs
+// that are not open, and clears those of configs that no longer have any.
+// Open configs are published with their findings. A config that just
+// failed to load is also reported with window/showMessage, since its
+// folder is scanned with the default rules until it is fixed.
+func (s *Server) publishConfigDiagnostics(glspContext *glsp.Context) {
+	current := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	failed := make(map[*Config]struct{})
+	for _, f := range s.getFolders() {
+		for _, c := range f.loadedConfigs() {
+			if c.Err() == nil {
+				continue
+			}
+			failed[c] = struct{}{}
+			if c.Path() == "" {
+				continue
+			}
+			uri := pathToURI(c.Path())
+			if diagnostics := s.configDiagnostics(uri); len(diagnostics) > 0 {
+				current[uri] = diagnostics
+			}
+		}
+	}
+
+	s.mu.Lock()
+	previous, previousFailed := s.configURIs, s.failedConfigs
+	s.configURIs = make(map[protocol.DocumentUri]struct{}, len(current))
+	for uri := range current {
+		s.configURIs[uri] = struct{}{}
+	}
+	s.failedConfigs = failed
+	s.mu.Unlock()
+
+	for c := range failed {
+		if _, ok := previousFailed[c]; !ok {
+			showConfigError(glspContext, c)
+		}
+	}
+
+	for uri := range previous {
+		if _, ok := current[uri]; !ok {
+			current[uri] = []protocol.Diagnostic{}
+		}
+	}
+
+	for uri, diagnostics := range current {
+		if _, open := s.documents.Get(uri); open {
+			continue
+		}
+		glspContext.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: diagnostics,
+		})
+	}
+}
+
+// showConfigError warns that the config c could not be loaded
+func showConfigError(glspContext *glsp.Context, c *Config) {
+	name := c.Path()
+	if name == "" {
+		name = string(c.Source())
+	}
+	glspContext.Notify(protocol.ServerWindowShowMessage, protocol.ShowMessageParams{
+		Type:    protocol.MessageTypeWarning,
+		Message: fmt.Sprintf("gitleaks: %s could not be loaded, the default rules are in effect: %v", name, c.Err()),
+	})
+}
+
 // FindingToDiagnostic converts a single finding to an LSP diagnostic
-func FindingToDiagnostic(f Finding) protocol.Diagnostic {
-	severity := GetDiagnosticSeverity()
+func FindingToDiagnostic(f Finding, severity protocol.DiagnosticSeverity) protocol.Diagnostic {
 	source := "gitleaks"
 	code := protocol.IntegerOrString{Value: f.RuleID}
 
@@ -64,7 +201,30 @@ func FindingToDiagnostic(f Finding) protocol.Diagnostic {
 		Source:   &source,
 		Message:  formatDiagnosticMessage(f),
 		Code:     &code,
+		Data:     diagnosticData{FindingID: f.ID},
+	}
+}
+
+// diagnosticData is attached to every diagnostic so that the finding behind
+// a diagnostic the client sends back can be resolved without relying on
+// the order of diagnostics
+type diagnosticData struct {
+	FindingID string `json:"findingId"`
+}
+
+// findingIDFromDiagnostic extracts the finding ID from a diagnostic's Data.
+// Data is a diagnosticData when built locally and a decoded JSON object
+// when it comes back from the client.
+func findingIDFromDiagnostic(diag protocol.Diagnostic) string {
+	switch data := diag.Data.(type) {
+	case diagnosticData:
+		return data.FindingID
+	case map[string]any:
+		if id, ok := data["findingId"].(string); ok {
+			return id
+		}
 	}
+	return ""
 }
 
 // formatDiagnosticMessage creates a human-readable diagnostic message
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
@@ -19,7 +21,7 @@ func TestFindingToDiagnostic(t *testing.T) {
 		Entropy:     3.5,
 	}
 
-	diag := FindingToDiagnostic(finding)
+	diag := FindingToDiagnostic(finding, protocol.DiagnosticSeverityWarning)
 
 	// Both LSP and gitleaks use 0-indexed lines and columns
 	// With no tabs: gitleaks column 5 (2-indexed for Line > 0) -> LSP position 3 (0-indexed)
@@ -45,7 +47,7 @@ func TestFindingToDiagnostic_MultiLine(t *testing.T) {
 		EndColumn:   15,
 	}
 
-	diag := FindingToDiagnostic(finding)
+	diag := FindingToDiagnostic(finding, protocol.DiagnosticSeverityWarning)
 
 	assert.Equal(t, uint32(5), diag.Range.Start.Line)
 	assert.Equal(t, uint32(7), diag.Range.End.Line)
@@ -62,7 +64,7 @@ func TestFindingToDiagnostic_NoEntropy(t *testing.T) {
 		Entropy:     0,
 	}
 
-	diag := FindingToDiagnostic(finding)
+	diag := FindingToDiagnostic(finding, protocol.DiagnosticSeverityWarning)
 
 	// Should not include entropy in message when it's 0
 	assert.NotContains(t, diag.Message, "entropy")
@@ -88,7 +90,7 @@ func TestFindingsToDiagnostics(t *testing.T) {
 		},
 	}
 
-	diagnostics := FindingsToDiagnostics(findings)
+	diagnostics := FindingsToDiagnostics(findings, protocol.DiagnosticSeverityWarning)
 
 	assert.Len(t, diagnostics, 2)
 	assert.Contains(t, diagnostics[0].Message, "rule-1")
@@ -97,6 +99,24 @@ func TestFindingsToDiagnostics(t *testing.T) {
 
 func TestFindingsToDiagnostics_Empty(t *testing.T) {
 	findings := []Finding{}
-	diagnostics := FindingsToDiagnostics(findings)
+	diagnostics := FindingsToDiagnostics(findings, protocol.DiagnosticSeverityWarning)
 	assert.Empty(t, diagnostics)
 }
+
+func TestFindingToDiagnostic_Data(t *testing.T) {
+	diag := FindingToDiagnostic(Finding{RuleID: "test-rule", ID: "abc123"}, protocol.DiagnosticSeverityWarning)
+	assert.Equal(t, "abc123", findingIDFromDiagnostic(diag))
+
+	// Data comes back from the client as a decoded JSON object
+	data, err := json.Marshal(diag)
+	require.NoError(t, err)
+	var decoded protocol.Diagnostic
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "abc123", findingIDFromDiagnostic(decoded))
+}
+
+func TestFindingIDFromDiagnostic_Missing(t *testing.T) {
+	assert.Empty(t, findingIDFromDiagnostic(protocol.Diagnostic{}))
+	assert.Empty(t, findingIDFromDiagnostic(protocol.Diagnostic{Data: "unexpected"}))
+	assert.Empty(t, findingIDFromDiagnostic(protocol.Diagnostic{Data: map[string]any{"findingId": 42}}))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// createDisableRuleActions creates code actions that stop rule f.RuleID
+// from reporting: one adds it to [extend] disabledRules of the config that
+// applies to the file, the other adds an [[allowlists]] entry for the rule
+// and the file. Without a config in the workspace one is created in its
+// root that extends the defaults. Configs named by the configPath setting
+// or the environment outside the workspace are left alone, as is a config
+// that does not parse.
+func (s *Server) createDisableRuleActions(folder *WorkspaceFolder, diag protocol.Diagnostic, f Finding) []protocol.CodeAction {
+	rootPath := folder.rootPath()
+	rel, ok := relativePath(rootPath, f.File)
+	if !ok {
+		return nil
+	}
+
+	configPath := folder.resolve(filepath.Dir(f.File)).configPath
+	if configPath == "" {
+		if folder.config.explicit() {
+			return nil
+		}
+		configPath = filepath.Join(rootPath, configNames[0])
+	} else if _, ok := relativePath(rootPath, configPath); !ok {
+		return nil
+	}
+
+	configURI := pathToURI(configPath)
+	content, exists := s.documentContent(configURI)
+	name := filepath.Base(configPath)
+	kind := protocol.CodeActionKindQuickFix
+
+	var actions []protocol.CodeAction
+	if edit, ok := disableRuleEdit(content, exists, f.RuleID); ok {
+		actions = append(actions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Disable %s for %s (%s)", f.RuleID, configScope(rootPath, configPath), name),
+			Kind:        &kind,
+			Edit:        &protocol.WorkspaceEdit{DocumentChanges: s.configChanges(configURI, exists, edit)},
+			Diagnostics: []protocol.Diagnostic{diag},
+		})
+	}
+	if edit, ok := allowlistEdit(content, exists, f.RuleID, rel); ok {
+		actions = append(actions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Disable %s for %s (%s)", f.RuleID, rel, name),
+			Kind:        &kind,
+			Edit:        &protocol.WorkspaceEdit{DocumentChanges: s.configChanges(configURI, exists, edit)},
+			Diagnostics: []protocol.Diagnostic{diag},
+		})
+	}
+	return actions
+}
+
+// configScope names the directory the config at configPath applies to:
+// the workspace for a config in its root, else the directory relative to
+// the root, such as "services/"
+func configScope(rootPath, configPath string) string {
+	for _, name := range configNames {
+		if dir, ok := strings.CutSuffix(configPath, string(filepath.Separator)+name); ok {
+			if rel, ok := relativePath(rootPath, dir); ok && rel != "." {
+				return rel + "/"
+			}
+			break
+		}
+	}
+	return "the workspace"
+}
+
+// configChanges returns the document changes that apply edit to the config
+// at uri, creating it first if it does not exist
+func (s *Server) configChanges(uri protocol.DocumentUri, exists bool, edit protocol.TextEdit) []any {
+	if !exists {
+		return s.appendFileChanges(uri, edit.NewText)
+	}
+
+	var version *protocol.Integer
+	if doc, ok := s.documents.Get(uri); ok {
+		version = &doc.Version
+	}
+	return []any{
+		protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				Version:                version,
+			},
+			Edits: []any{edit},
+		},
+	}
+}
+
+// disableRuleEdit returns the edit that adds ruleID to [extend]
+// disabledRules of a config, or the content of a new config extending the
+// defaults if it does not exist. disabledRules only applies to the rules of
+// the extended config, so there is no edit for configs that extend nothing
+// or define the rule themselves, or if the rule is disabled already.
+func disableRuleEdit(content string, exists bool, ruleID string) (protocol.TextEdit, bool) {
+	rule := strconv.Quote(ruleID)
+	if !exists {
+		return protocol.TextEdit{NewText: "[extend]\nuseDefault = true\ndisabledRules = [" + rule + "]\n"}, true
+	}
+
+	vc, err := parseViperConfig(content)
+	if err != nil || (!vc.Extend.UseDefault && vc.Extend.Path == "") || slices.Contains(vc.Extend.DisabledRules, ruleID) {
+		return protocol.TextEdit{}, false
+	}
+	for _, r := range vc.Rules {
+		if r.ID == ruleID {
+			return protocol.TextEdit{}, false
+		}
+	}
+
+	lines := parseTOMLLines(content)
+	last := -1 // last line of the [extend] table with content
+	for i, line := range lines {
+		if line.table != "extend" {
+			continue
+		}
+		if line.key == "disabledRules" {
+			return insertIntoArray(content, line.offset+line.keyStart, rule)
+		}
+		if text, _, _ := strings.Cut(content[line.offset:], "\n"); strings.TrimSpace(text) != "" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return protocol.TextEdit{}, false
+	}
+
+	// Add the key after the last line of the table
+	text := "disabledRules = [" + rule + "]\n"
+	offset := len(content)
+	if last+1 < len(lines) {
+		offset = lines[last+1].offset
+	} else if !strings.HasSuffix(content, "\n") {
+		text = "\n" + text
+	}
+	line, column := offsetPosition(content, offset)
+	pos := protocol.Position{Line: line, Character: column}
+	return protocol.TextEdit{Range: protocol.Range{Start: pos, End: pos}, NewText: text}, true
+}
+
+// insertIntoArray returns the edit that appends value to the TOML array
+// assigned by the key at offset in content
+func insertIntoArray(content string, offset int, value string) (protocol.TextEdit, bool) {
+	open := strings.IndexByte(content[offset:], '[')
+	if open < 0 {
+		return protocol.TextEdit{}, false
+	}
+
+	// Find the closing bracket and the last item, outside strings and comments
+	last := offset + open
+	depth, quote := 0, ""
+	for i := offset + open; i < len(content); i++ {
+		rest := content[i:]
+		switch {
+		case quote != "":
+			if quote[0] == '"' && rest[0] == '\\' {
+				i++
+			} else if strings.HasPrefix(rest, quote) {
+				i += len(quote) - 1
+				quote = ""
+				last = i
+			}
+		case rest[0] == '#':
+			if end := strings.IndexByte(rest, '\n'); end > 0 {
+				i += end - 1
+			} else {
+				i = len(content)
+			}
+		case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, "'''"):
+			quote = rest[:3]
+			i += 2
+		case rest[0] == '"', rest[0] == '\'':
+			quote = rest[:1]
+		case rest[0] == '[':
+			depth++
+			last = i
+		case rest[0] == ']':
+			depth--
+			if depth == 0 {
+				text := ", " + value
+				switch content[last] {
+				case '[':
+					text = value
+				case ',':
+					text = " " + value
+				}
+				line, column := offsetPosition(content, last+1)
+				pos := protocol.Position{Line: line, Character: column}
+				return protocol.TextEdit{Range: protocol.Range{Start: pos, End: pos}, NewText: text}, true
+			}
+			last = i
+		case rest[0] != ' ' && rest[0] != '\t' && rest[0] != '\r' && rest[0] != '\n':
+			last = i
+		}
+	}
+	return protocol.TextEdit{}, false
+}
+
+// allowlistEdit returns the edit that appends an [[allowlists]] entry for
+// ruleID and the file at rel, a slash-separated path relative to the
+// workspace root, to a config, or the content of a new config extending
+// the defaults if it does not exist
+func allowlistEdit(content string, exists bool, ruleID, rel string) (protocol.TextEdit, bool) {
+	// Scanned paths may be absolute, so the path is matched at its end
+	entry := fmt.Sprintf("[[allowlists]]\ndescription = %s\ntargetRules = [%s]\npaths = ['''(^|/)%s$''']\n",
+		strconv.Quote(fmt.Sprintf("Findings of %s in %s", ruleID, rel)), strconv.Quote(ruleID), regexp.QuoteMeta(rel))
+	if !exists {
+		return protocol.TextEdit{NewText: "[extend]\nuseDefault = true\n\n" + entry}, true
+	}
+	if _, err := parseViperConfig(content); err != nil {
+		return protocol.TextEdit{}, false
+	}
+
+	text := "\n" + entry
+	if content == "" {
+		text = entry
+	} else if !strings.HasSuffix(content, "\n") {
+		text = "\n\n" + entry
+	}
+	end := NewTextBuffer(content).End()
+	return protocol.TextEdit{Range: protocol.Range{Start: end, End: end}, NewText: text}, true
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/zricethezav/gitleaks/v8/config"
+	"github.com/zricethezav/gitleaks/v8/report"
+)
+
+// reportExtensions maps the supported report formats to the extension of
+// their default file name
+var reportExtensions = map[string]string{
+	"sarif": "sarif",
+	"json":  "json",
+	"csv":   "csv",
+	"junit": "xml",
+}
+
+// errUnknownReportFormat is returned for formats gitleaks cannot write
+var errUnknownReportFormat = errors.New("unknown report format")
+
+// ExportOptions selects the format and file of an exported report. A
+// relative path is resolved against the workspace root; an empty one
+// defaults to gitleaks-report.<ext> in the root.
+type ExportOptions struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+}
+
+// parseExportOptions decodes the options object passed as a command argument
+func parseExportOptions(arg any) (ExportOptions, error) {
+	var opts ExportOptions
+	data, err := json.Marshal(arg)
+	if err != nil {
+		return opts, err
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return opts, fmt.Errorf("invalid export options: %w", err)
+	}
+	opts.Format = strings.ToLower(opts.Format)
+	if opts.Format == "" {
+		opts.Format = "sarif"
+	}
+	if _, ok := reportExtensions[opts.Format]; !ok {
+		return opts, fmt.Errorf("%w: %q", errUnknownReportFormat, opts.Format)
+	}
+	return opts, nil
+}
+
+// reportPath resolves the file the report is written to
+func (o ExportOptions) reportPath(rootPath string) string {
+	path := o.Path
+	if path == "" {
+		path = "gitleaks-report." + reportExtensions[o.Format]
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootPath, path)
+	}
+	return filepath.Clean(path)
+}
+
+// newReporter returns the gitleaks reporter for format. SARIF reports list
+// the rules of cfg.
+func newReporter(format string, cfg config.Config) (report.Reporter, error) {
+	switch format {
+	case "sarif":
+		return &report.SarifReporter{OrderedRules: cfg.GetOrderedRules()}, nil
+	case "json":
+		return &report.JsonReporter{}, nil
+	case "csv":
+		return &report.CsvReporter{}, nil
+	case "junit":
+		return &report.JunitReporter{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownReportFormat, format)
+	}
+}
+
+// reportScope returns, for the file of a finding, the root its path is
+// reported relative to and the config whose rules it was found with
+type reportScope func(file string) (rootPath string, cfg config.Config)
+
+// toReportFindings converts the findings of a workspace scan to gitleaks
+// findings as the CLI reports them: files relative to their root, 1-based
+// lines, and the tags of the rule from their config. redact is the setting
+// the findings were scanned with: with redaction on, their secrets are
+// masked by that percentage already; without it, they are masked fully,
+// since the report is written next to the code it describes. The findings
+// are sorted by file and line.
+func toReportFindings(result *WorkspaceScanResult, scope reportScope, redact uint) []report.Finding {
+	findings := make([]report.Finding, 0, result.TotalFindings)
+	for _, fileFindings := range result.Findings {
+		for _, f := range fileFindings {
+			rootPath, cfg := scope(f.File)
+			rf := report.Finding{
+				RuleID:      f.RuleID,
+				Description: f.Description,
+				StartLine:   f.StartLine + 1,
+				EndLine:     f.EndLine + 1,
+				StartColumn: f.StartColumn,
+				EndColumn:   f.EndColumn,
+				Line:        f.Line,
+				Match:       f.Match,
+				Secret:      f.Secret,
+				File:        fingerprintPath(rootPath, f.File),
+				Commit:      f.Commit,
+				Link:        f.Link,
+				Entropy:     f.Entropy,
+				Author:      f.Author,
+				Email:       f.Email,
+				Date:        f.Date,
+				Message:     f.Message,
+				Tags:        []string{},
+				Fingerprint: f.Fingerprint,
+			}
+			if redact == 0 {
+				rf.Redact(100)
+			}
+			if rule, ok := cfg.Rules[f.RuleID]; ok && rule.Tags != nil {
+				rf.Tags = rule.Tags
+			}
+			findings = append(findings, rf)
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b report.Finding) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine - b.StartLine
+		}
+		return a.StartColumn - b.StartColumn
+	})
+	return findings
+}
+
+// ExportReport writes the findings of a workspace scan to path in the given
+// format, using the gitleaks reporters. SARIF reports list the rules of
+// cfg, whose Rules and OrderedRules may come from several configs. Secrets
+// are masked according to redact, see toReportFindings.
+func ExportReport(result *WorkspaceScanResult, path, format string, cfg config.Config, scope reportScope, redact uint) error {
+	reporter, err := newReporter(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report: %w", err)
+	}
+
+	if err := reporter.Write(file, toReportFindings(result, scope, redact)); err != nil {
+		file.Close()
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return file.Close()
+}
+
+// exportWorkspaceResult writes result as described by opts and returns the
+// path of the report. Relative paths are resolved against the first
+// workspace folder. Each finding is reported relative to the folder that
+// contains it, with the rules of the config it was scanned with.
+func (s *Server) exportWorkspaceResult(result *WorkspaceScanResult, opts ExportOptions) (string, error) {
+	path := opts.reportPath(s.getFolders()[0].rootPath())
+	scope := func(file string) (string, config.Config) {
+		folder := s.folderFor(pathToURI(file))
+		return folder.rootPath(), folder.scannerFor(file).config
+	}
+	if err := ExportReport(result, path, opts.Format, s.reportConfig(), scope, s.settings.Redact()); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	if s.reports == nil {
+		s.reports = make(map[string]struct{})
+	}
+	s.reports[path] = struct{}{}
+	s.mu.Unlock()
+
+	slog.Info("exported report",
+		"path", path,
+		"format", opts.Format,
+		"findings", result.TotalFindings)
+	return path, nil
+}
+
+// reportConfig returns a config holding the rules of every workspace
+// folder and nested project loaded so far, in order and without repeats,
+// for the rule list of SARIF reports
+func (s *Server) reportConfig() config.Config {
+	merged := config.Config{Rules: make(map[string]config.Rule)}
+	for _, folder := range s.getFolders() {
+		for _, c := range folder.loadedConfigs() {
+			cfg := c.GetConfig()
+			for _, rule := range cfg.GetOrderedRules() {
+				if _, ok := merged.Rules[rule.RuleID]; !ok {
+					merged.Rules[rule.RuleID] = rule
+					merged.OrderedRules = append(merged.OrderedRules, rule.RuleID)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// isReport reports whether path is a report written by exportReport: one
+// written since the server started, or one with the default name of a
+// report, so that reports of earlier sessions are skipped as well
+func (s *Server) isReport(path string) bool {
+	for _, ext := range reportExtensions {
+		if filepath.Base(path) == "gitleaks-report."+ext {
+			return true
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.reports[path]
+	return ok
+}
+
+// handleExportReportCommand handles the exportReport command. The optional
+// first argument is an ExportOptions object. The last workspace scan is
+// exported, running one first if there is none.
+func (s *Server) handleExportReportCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	var arg any
+	if len(params.Arguments) > 0 {
+		arg = params.Arguments[0]
+	}
+	opts, err := parseExportOptions(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.getWorkspaceResult()
+	if result == nil {
+		if _, err := s.handleScanWorkspaceCommand(ctx, &protocol.ExecuteCommandParams{}); err != nil {
+			return nil, err
+		}
+		if result = s.getWorkspaceResult(); result == nil {
+			return nil, nil
+		}
+	}
+
+	path, err := s.exportWorkspaceResult(result, opts)
+	if err != nil {
+		slog.Error("report export failed", "error", err)
+		return nil, err
+	}
+
+	return map[string]any{
+		"path":          path,
+		"format":        opts.Format,
+		"totalFindings": result.TotalFindings,
+	}, nil
+}
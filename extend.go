@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+var (
+	errExtendCycle    = errors.New("config extends itself")
+	errExtendNotFound = errors.New("extended config not found")
+	errExtendConflict = errors.New("extend.path and extend.useDefault cannot both be set")
+)
+
+// chainReader reads config chains. Files in overlay, such as the unsaved
+// content of an open document, are read from there instead of the disk.
+type chainReader struct {
+	overlay map[string]string
+}
+
+// readFile returns the content of the file at path
+func (r chainReader) readFile(path string) ([]byte, error) {
+	if content, ok := r.overlay[path]; ok {
+		return []byte(content), nil
+	}
+	return os.ReadFile(path)
+}
+
+// exists reports whether there is a file at path
+func (r chainReader) exists(path string) bool {
+	if _, ok := r.overlay[path]; ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// readConfigChain reads the config at path and the configs it extends. It
+// returns the merged config and the files of the chain, starting with
+// path, which are returned even if one of them cannot be read. Errors
+// are *configError where the file at fault is known.
+//
+// gitleaks follows [extend] itself, but resolves relative paths against
+// the working directory and stops extending for good after two levels in
+// a process, so the chain is merged here before translating it.
+func readConfigChain(path string) (config.Config, []string, error) {
+	return chainReader{}.readConfigChain(path)
+}
+
+func (r chainReader) readConfigChain(path string) (config.Config, []string, error) {
+	vc, files, err := r.readViperChain(path, nil)
+	if err != nil {
+		return config.Config{}, files, err
+	}
+
+	cfg, err := translateConfig(vc)
+	if err != nil {
+		return config.Config{}, files, r.locateConfigError(err, files)
+	}
+	cfg.Path = path
+	return cfg, files, nil
+}
+
+// readConfigContent is readConfigChain for a config given as content, as
+// in GITLEAKS_CONFIG_TOML. Its relative extend paths resolve against the
+// working directory like the CLI's.
+func readConfigContent(content string) (config.Config, []string, error) {
+	vc, err := parseViperConfig(content)
+	if err != nil {
+		return config.Config{}, nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	vc, files, err := chainReader{}.extendViperConfig(vc, "", nil)
+	if err != nil {
+		return config.Config{}, files, err
+	}
+
+	cfg, err := translateConfig(vc)
+	if err != nil {
+		return config.Config{}, files, err
+	}
+	return cfg, files, nil
+}
+
+// parseViperConfig decodes the content of a config
+func parseViperConfig(content string) (config.ViperConfig, error) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(content)); err != nil {
+		return config.ViperConfig{}, err
+	}
+	return unmarshalConfig(v)
+}
+
+// readViperChain reads the config at path with the configs it extends
+// merged in. chain holds the files that extend path, in order.
+func (r chainReader) readViperChain(path string, chain []string) (config.ViperConfig, []string, error) {
+	chain = append(chain, path)
+
+	content, err := r.readFile(path)
+	if err != nil {
+		return config.ViperConfig{}, chain, &configError{path: path, err: err}
+	}
+
+	vc, err := parseViperConfig(string(content))
+	if err != nil {
+		return config.ViperConfig{}, chain, readError(path, err)
+	}
+	return r.extendViperConfig(vc, path, chain)
+}
+
+// extendViperConfig merges the config that vc, read from path, extends
+// into it. The extend path is relative to the directory of path.
+func (r chainReader) extendViperConfig(vc config.ViperConfig, path string, chain []string) (config.ViperConfig, []string, error) {
+	extend := vc.Extend
+	vc.Extend = config.Extend{}
+
+	switch {
+	case extend.Path != "" && extend.UseDefault:
+		return vc, chain, r.extendError(path, errExtendConflict)
+
+	case extend.UseDefault:
+		base, err := parseViperConfig(config.DefaultConfig)
+		if err != nil {
+			return vc, chain, fmt.Errorf("reading default config: %w", err)
+		}
+		return mergeViperConfig(vc, base, extend.DisabledRules), chain, nil
+
+	case extend.Path != "":
+		basePath := extendBasePath(path, extend.Path)
+
+		if slices.Contains(chain, basePath) {
+			err := fmt.Errorf("%w: %s", errExtendCycle, strings.Join(append(chain, basePath), " -> "))
+			return vc, chain, r.extendError(path, err)
+		}
+		if !r.exists(basePath) {
+			err := fmt.Errorf("%w: %s", errExtendNotFound, basePath)
+			return vc, append(chain, basePath), r.extendError(path, err)
+		}
+
+		base, files, err := r.readViperChain(basePath, chain)
+		if err != nil {
+			return vc, files, err
+		}
+		return mergeViperConfig(vc, base, extend.DisabledRules), files, nil
+	}
+
+	return vc, chain, nil
+}
+
+// extendBasePath resolves the extend path of the config at path
+func extendBasePath(path, extendPath string) string {
+	if filepath.IsAbs(extendPath) {
+		return extendPath
+	}
+	return filepath.Join(filepath.Dir(path), extendPath)
+}
+
+// mergeViperConfig adds the rules and allowlists of base to vc the way
+// gitleaks extends a config: rules of vc override the non-empty fields of
+// base rules with the same ID and add to their keywords, tags and
+// allowlists, and disabled base rules are left out.
+func mergeViperConfig(vc, base config.ViperConfig, disabled []string) config.ViperConfig {
+	byID := make(map[string]int, len(vc.Rules))
+	for i := range vc.Rules {
+		byID[vc.Rules[i].ID] = i
+	}
+
+	for _, baseRule := range base.Rules {
+		if slices.Contains(disabled, baseRule.ID) {
+			continue
+		}
+
+		i, ok := byID[baseRule.ID]
+		if !ok {
+			vc.Rules = append(vc.Rules, baseRule)
+			continue
+		}
+
+		current := vc.Rules[i]
+		if current.Description != "" {
+			baseRule.Description = current.Description
+		}
+		if current.Entropy != 0 {
+			baseRule.Entropy = current.Entropy
+		}
+		if current.SecretGroup != 0 {
+			baseRule.SecretGroup = current.SecretGroup
+		}
+		if current.Regex != "" {
+			baseRule.Regex = current.Regex
+		}
+		if current.Path != "" {
+			baseRule.Path = current.Path
+		}
+		baseRule.Tags = append(baseRule.Tags, current.Tags...)
+		baseRule.Keywords = append(baseRule.Keywords, current.Keywords...)
+
+		// The deprecated single allowlist cannot be combined with others
+		if baseRule.AllowList != nil {
+			baseRule.Allowlists = append(baseRule.Allowlists, baseRule.AllowList)
+			baseRule.AllowList = nil
+		}
+		baseRule.Allowlists = append(baseRule.Allowlists, current.Allowlists...)
+		if current.AllowList != nil {
+			baseRule.Allowlists = append(baseRule.Allowlists, current.AllowList)
+		}
+		vc.Rules[i] = baseRule
+	}
+
+	// Allowlists are appended, not merged
+	if base.AllowList != nil {
+		base.Allowlists = append(base.Allowlists, base.AllowList)
+	}
+	if len(base.Allowlists) > 0 && vc.AllowList != nil {
+		vc.Allowlists = append(vc.Allowlists, vc.AllowList)
+		vc.AllowList = nil
+	}
+	vc.Allowlists = append(vc.Allowlists, base.Allowlists...)
+
+	// gitleaks keeps extended rules in order of their IDs
+	sort.SliceStable(vc.Rules, func(i, j int) bool {
+		return vc.Rules[i].ID < vc.Rules[j].ID
+	})
+	return vc
+}
+
+// extendPathPattern matches the path key of the [extend] table
+var extendPathPattern = regexp.MustCompile(`^\s*path\s*=`)
+
+// extendPathLine returns the 0-based line of the path key of the [extend]
+// table in a config, or 0 if there is none
+func extendPathLine(content string) uint32 {
+	inExtend := false
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inExtend = trimmed == "[extend]"
+			continue
+		}
+		if inExtend && extendPathPattern.MatchString(line) {
+			return uint32(i)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// writeConfig writes a config file, creating its directory
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestReadConfigChain(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.toml")
+	middle := filepath.Join(dir, "shared", "middle.toml")
+	child := filepath.Join(dir, "services", "api", ".gitleaks.toml")
+
+	writeConfig(t, base, "[[rules]]\nid = \"base\"\ndescription = \"Base\"\nregex = '''base_[a-z]{8}'''\n")
+	writeConfig(t, middle, "[extend]\npath = \"../base.toml\"\n\n[[rules]]\nid = \"middle\"\nregex = '''middle_[a-z]{8}'''\n")
+	writeConfig(t, child, "[extend]\npath = \"../../shared/middle.toml\"\n\n[[rules]]\nid = \"child\"\nregex = '''child_[a-z]{8}'''\n")
+
+	// Relative paths resolve against the extending file, past the two
+	// levels gitleaks follows, however often the chain is read
+	for range 3 {
+		cfg, files, err := readConfigChain(child)
+		require.NoError(t, err)
+		assert.Equal(t, []string{child, middle, base}, files)
+		assert.Equal(t, child, cfg.Path)
+		assert.Contains(t, cfg.Rules, "base")
+		assert.Contains(t, cfg.Rules, "middle")
+		assert.Contains(t, cfg.Rules, "child")
+	}
+}
+
+func TestReadConfigChain_Override(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, "base.toml"),
+		"[[rules]]\nid = \"base\"\ndescription = \"Base\"\nregex = '''base_[a-z]{8}'''\n\n"+
+			"[[rules]]\nid = \"noisy\"\nregex = '''noisy_[a-z]{8}'''\n")
+
+	// A rule with the ID of a base rule only changes what it sets
+	child := filepath.Join(dir, ".gitleaks.toml")
+	writeConfig(t, child, "[extend]\npath = \"base.toml\"\ndisabledRules = [\"noisy\"]\n\n"+
+		"[[rules]]\nid = \"base\"\ndescription = \"Overridden\"\n[[rules.allowlists]]\nregexes = ['''base_example''']\n")
+
+	cfg, _, err := readConfigChain(child)
+	require.NoError(t, err)
+	require.Contains(t, cfg.Rules, "base")
+	assert.NotContains(t, cfg.Rules, "noisy")
+
+	rule := cfg.Rules["base"]
+	assert.Equal(t, "Overridden", rule.Description)
+	assert.Equal(t, "base_[a-z]{8}", rule.Regex.String())
+	assert.Len(t, rule.Allowlists, 1)
+}
+
+func TestReadConfigChain_Errors(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.toml")
+	b := filepath.Join(dir, "b.toml")
+
+	writeConfig(t, a, "[extend]\npath = \"b.toml\"\n")
+	writeConfig(t, b, "[extend]\npath = \"a.toml\"\n")
+	_, files, err := readConfigChain(a)
+	assert.ErrorIs(t, err, errExtendCycle)
+	assert.Equal(t, []string{a, b}, files)
+
+	// The missing file is part of the chain, so creating it is noticed
+	writeConfig(t, b, "[extend]\npath = \"missing.toml\"\n")
+	_, files, err = readConfigChain(a)
+	assert.ErrorIs(t, err, errExtendNotFound)
+	assert.Equal(t, []string{a, b, filepath.Join(dir, "missing.toml")}, files)
+
+	writeConfig(t, b, "[extend]\npath = \"a.toml\"\nuseDefault = true\n")
+	_, _, err = readConfigChain(b)
+	assert.ErrorIs(t, err, errExtendConflict)
+
+	// The config falls back to the defaults and keeps the error
+	cfg, err := NewConfigAt(a, dir, NewServerSettings(), nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, cfg.Err(), errExtendConflict)
+	assert.NotEmpty(t, cfg.GetConfig().Rules)
+}
+
+func TestExtendPathLine(t *testing.T) {
+	assert.Equal(t, uint32(0), extendPathLine("[[rules]]\nid = \"x\"\npath = '''x'''\n"))
+	assert.Equal(t, uint32(3), extendPathLine("title = \"x\"\n\n[extend]\npath = \"base.toml\"\n"))
+	assert.Equal(t, uint32(0), extendPathLine("[extend]\nuseDefault = true\n[[rules]]\npath = '''x'''\n"))
+}
+
+func TestIntegration_ExtendChain(t *testing.T) {
+	var mu sync.Mutex
+	published := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	ctx := &glsp.Context{
+		Notify: func(method string, params any) {
+			if p, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				mu.Lock()
+				published[p.URI] = p.Diagnostics
+				mu.Unlock()
+			}
+		},
+	}
+	lastDiagnostics := func(uri protocol.DocumentUri) ([]protocol.Diagnostic, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		diagnostics, ok := published[uri]
+		return diagnostics, ok
+	}
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	base := filepath.Join(dir, "base.toml")
+	configPath := filepath.Join(root, ".gitleaks.toml")
+	writeConfig(t, base, "[[rules]]\nid = \"old\"\nregex = '''old_[a-z]{8}'''\n")
+	writeConfig(t, configPath, "title = \"repo\"\n\n[extend]\npath = \"../base.toml\"\n")
+
+	s := newMultiRootServer(t, ctx, root)
+	require.NoError(t, s.initialized(ctx, &protocol.InitializedParams{}))
+
+	uri := pathToURI(filepath.Join(root, "main.go"))
+	require.NoError(t, s.textDocumentDidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: "token := \"new_abcdefgh\"\n"},
+	}))
+	diagnostics, _ := lastDiagnostics(uri)
+	assert.Empty(t, diagnostics)
+
+	// Editing the base file reloads the config extending it
+	writeConfig(t, base, "[[rules]]\nid = \"new\"\nregex = '''new_[a-z]{8}'''\n")
+	assert.Eventually(t, func() bool {
+		diagnostics, _ := lastDiagnostics(uri)
+		return len(diagnostics) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// A cycle is reported on the [extend] path of the config
+	configURI := pathToURI(configPath)
+	writeConfig(t, base, "[extend]\npath = \"repo/.gitleaks.toml\"\n")
+	require.Eventually(t, func() bool {
+		diagnostics, _ := lastDiagnostics(configURI)
+		return len(diagnostics) == 1 && diagnostics[0].Range.Start.Line == 3
+	}, 5*time.Second, 20*time.Millisecond)
+	diagnostics, _ = lastDiagnostics(configURI)
+	assert.Contains(t, diagnostics[0].Message, "config extends itself")
+
+	// Fixing it clears the diagnostic
+	writeConfig(t, base, "[[rules]]\nid = \"new\"\nregex = '''new_[a-z]{8}'''\n")
+	assert.Eventually(t, func() bool {
+		diagnostics, _ := lastDiagnostics(configURI)
+		return len(diagnostics) == 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+// envStyle is how a language reads an environment variable
+type envStyle struct {
+	format  string // lookup of the variable, %s is its name
+	literal bool   // the lookup replaces the whole string literal holding the secret
+	shell   bool   // single quotes keep the lookup from expanding
+
+	// imports returns the line before which to insert text to import what
+	// the lookup needs, or "" if it is imported already. It reports false
+	// if there is no place for the import.
+	imports func(lines []string) (line int, text string, ok bool)
+}
+
+// envStyles lists the environment variable lookup of languages by LSP
+// languageId
+var envStyles = map[string]envStyle{
+	"go":              {format: `os.Getenv("%s")`, literal: true, imports: goImport},
+	"javascript":      {format: "process.env.%s", literal: true},
+	"javascriptreact": {format: "process.env.%s", literal: true},
+	"typescript":      {format: "process.env.%s", literal: true},
+	"typescriptreact": {format: "process.env.%s", literal: true},
+	"python":          {format: `os.environ["%s"]`, literal: true, imports: pythonImport},
+	"ruby":            {format: `ENV["%s"]`, literal: true},
+	"java":            {format: `System.getenv("%s")`, literal: true},
+	"kotlin":          {format: `System.getenv("%s")`, literal: true},
+	"csharp":          {format: `System.Environment.GetEnvironmentVariable("%s")`, literal: true},
+	"php":             {format: `getenv("%s")`, literal: true},
+
+	// Interpolated where the secret is, as Docker Compose and shells do
+	"yaml":          {format: "${%s}"},
+	"dockercompose": {format: "${%s}"},
+	"shellscript":   {format: "${%s}", shell: true},
+}
+
+// getEnvStyle returns the environment variable lookup for a document,
+// found in commentLanguages like getCommentSyntax. Languages without one
+// get no action.
+func getEnvStyle(languageID, filename string) (envStyle, bool) {
+	if style, ok := envStyles[languageID]; ok {
+		return style, true
+	}
+	i, ok := findLanguage(languageID, filename)
+	if !ok {
+		return envStyle{}, false
+	}
+	for _, id := range commentLanguages[i].ids {
+		if style, ok := envStyles[id]; ok {
+			return style, true
+		}
+	}
+	return envStyle{}, false
+}
+
+// goImport adds "os" to the first import declaration of a Go file, or
+// after its package clause if it has none
+func goImport(lines []string) (int, string, bool) {
+	pkg, at, text := -1, -1, ""
+	inBlock := false
+loop:
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock || strings.HasPrefix(line, "import"):
+			spec := line
+			if !inBlock {
+				spec = strings.TrimSpace(strings.TrimPrefix(line, "import"))
+			}
+			if spec == "(" {
+				inBlock = true
+				if at < 0 {
+					at, text = i+1, "\t\"os\"\n"
+				}
+				continue
+			}
+			if fields := strings.Fields(spec); len(fields) > 0 && fields[0] == `"os"` {
+				return 0, "", true
+			}
+			if at < 0 && !inBlock {
+				at, text = i, "import \"os\"\n"
+			}
+		case strings.HasPrefix(line, "package "):
+			pkg = i
+		case strings.HasPrefix(line, "func "), strings.HasPrefix(line, "var "),
+			strings.HasPrefix(line, "const "), strings.HasPrefix(line, "type "):
+			// Imports come before the declarations
+			break loop
+		}
+	}
+	if at < 0 && pkg >= 0 {
+		return pkg + 1, "\nimport \"os\"\n", true
+	}
+	return at, text, at >= 0
+}
+
+// pythonImport adds "import os" before the first import of a Python
+// module, after its __future__ imports, or else after its leading
+// comments and docstring
+func pythonImport(lines []string) (int, string, bool) {
+	at, future := -1, -1
+	for i, line := range lines {
+		if names, ok := strings.CutPrefix(line, "import "); ok {
+			names, _, _ = strings.Cut(names, "#")
+			for _, name := range strings.Split(names, ",") {
+				if strings.TrimSpace(name) == "os" {
+					return 0, "", true
+				}
+			}
+		}
+		switch {
+		case strings.HasPrefix(line, "from __future__ "):
+			future = i
+		case at < 0 && (strings.HasPrefix(line, "import ") || strings.HasPrefix(line, "from ")):
+			at = i
+		}
+	}
+	if future >= 0 {
+		return future + 1, "import os\n", true
+	}
+	if at >= 0 {
+		return at, "import os\n", true
+	}
+
+	at = 0
+	for at < len(lines) && (strings.TrimSpace(lines[at]) == "" || strings.HasPrefix(lines[at], "#")) {
+		at++
+	}
+	if at < len(lines) {
+		for _, quote := range []string{`"""`, `'''`} {
+			rest, ok := strings.CutPrefix(lines[at], quote)
+			if !ok {
+				continue
+			}
+			if strings.Contains(rest, quote) {
+				return at + 1, "import os\n", true
+			}
+			for end := at + 1; end < len(lines); end++ {
+				if strings.Contains(lines[end], quote) {
+					return end + 1, "import os\n", true
+				}
+			}
+			return 0, "", false
+		}
+	}
+	return at, "import os\n", true
+}
+
+// createExtractEnvAction creates a code action that replaces the secret of
+// f with an environment variable lookup and appends the variable to the
+// .env file of the workspace root, which is added to .gitignore unless it
+// is already ignored. The package the lookup needs is imported. No action
+// is offered for languages without a lookup, secrets that are not a whole
+// string literal where the lookup needs one or that .env cannot hold, or
+// files outside the workspace.
+func (s *Server) createExtractEnvAction(uri protocol.DocumentUri, rootPath, content string, diag protocol.Diagnostic, f Finding, rule config.Rule) (protocol.CodeAction, bool) {
+	style, ok := getEnvStyle(s.documentLanguage(uri), f.File)
+	if !ok {
+		return protocol.CodeAction{}, false
+	}
+	if _, ok := relativePath(rootPath, f.File); !ok {
+		return protocol.CodeAction{}, false
+	}
+
+	line, start, end, ok := secretRange(content, f, rule)
+	if !ok {
+		return protocol.CodeAction{}, false
+	}
+	lines := strings.Split(content, "\n")
+	text := lines[line]
+	secret := text[start:end]
+
+	if style.literal {
+		if start == 0 || end == len(text) || !strings.ContainsRune("\"'`", rune(text[start-1])) || text[end] != text[start-1] {
+			return protocol.CodeAction{}, false
+		}
+		start, end = start-1, end+1
+	}
+
+	envURI := pathToURI(filepath.Join(rootPath, ".env"))
+	envContent, _ := s.documentContent(envURI)
+	name, defined := envName(envContent, envVarName(f.RuleID), secret)
+	value, ok := envValue(secret)
+	if !defined && !ok {
+		return protocol.CodeAction{}, false
+	}
+
+	lookup := fmt.Sprintf(style.format, name)
+	if style.shell && inSingleQuotes(text, start) {
+		// Only a string of the secret alone can be double-quoted instead
+		if text[start-1] != '\'' || end == len(text) || text[end] != '\'' {
+			return protocol.CodeAction{}, false
+		}
+		start, end = start-1, end+1
+		lookup = `"` + lookup + `"`
+	}
+
+	// Positions are in UTF-16 code units
+	edits := []any{protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(line), Character: uint32(utf16Length(text[:start]))},
+			End:   protocol.Position{Line: uint32(line), Character: uint32(utf16Length(text[:end]))},
+		},
+		NewText: lookup,
+	}}
+	if style.imports != nil {
+		at, importText, ok := style.imports(lines)
+		if !ok {
+			return protocol.CodeAction{}, false
+		}
+		if importText != "" {
+			pos := protocol.Position{Line: uint32(at)}
+			edits = append([]any{protocol.TextEdit{Range: protocol.Range{Start: pos, End: pos}, NewText: importText}}, edits...)
+		}
+	}
+
+	var version *protocol.Integer
+	if doc, ok := s.documents.Get(uri); ok {
+		version = &doc.Version
+	}
+	changes := []any{
+		protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				Version:                version,
+			},
+			Edits: edits,
+		},
+	}
+	if !defined {
+		changes = append(changes, s.appendFileChanges(envURI, name+"="+value+"\n")...)
+	}
+
+	gitignoreURI := pathToURI(filepath.Join(rootPath, ".gitignore"))
+	if gitignore, _ := s.documentContent(gitignoreURI); !gitignoreMatches(gitignore, ".env") {
+		changes = append(changes, s.appendFileChanges(gitignoreURI, ".env\n")...)
+	}
+
+	kind := protocol.CodeActionKindRefactorExtract
+
+	return protocol.CodeAction{
+		Title:       fmt.Sprintf("Move secret to environment variable %s (.env)", name),
+		Kind:        &kind,
+		Edit:        &protocol.WorkspaceEdit{DocumentChanges: changes},
+		Diagnostics: []protocol.Diagnostic{diag},
+	}, true
+}
+
+// inSingleQuotes reports whether the byte offset of a shell line is inside
+// a single-quoted string
+func inSingleQuotes(text string, offset int) bool {
+	var quote byte
+	for i := 0; i < offset && i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != '\'' && c == '\\':
+			i++
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case c == quote:
+			quote = 0
+		}
+	}
+	return quote == '\''
+}
+
+// secretRange returns the line and byte columns of the secret of f in
+// content. The secret is taken from the document with the regex of its
+// rule, as gitleaks does from the match, since f.Secret may be redacted.
+// Secrets spanning lines are not supported.
+func secretRange(content string, f Finding, rule config.Rule) (line, start, end int, ok bool) {
+	lines := strings.Split(content, "\n")
+	if f.StartLine != f.EndLine || f.StartLine >= len(lines) {
+		return 0, 0, 0, false
+	}
+
+	text := lines[f.StartLine]
+	start = int(adjustColumn(f.StartColumn, f.StartLine, false))
+	end = int(adjustColumn(f.EndColumn, f.StartLine, true))
+	if start >= end || end > len(text) {
+		return 0, 0, 0, false
+	}
+
+	// The secret is the secret group, or else the first non-empty group
+	if rule.Regex != nil {
+		groups := rule.Regex.FindStringSubmatchIndex(text[start:end])
+		if len(groups) >= 4 {
+			group := rule.SecretGroup
+			if group == 0 {
+				for i := 1; i < len(groups)/2; i++ {
+					if groups[2*i] >= 0 && groups[2*i+1] > groups[2*i] {
+						group = i
+						break
+					}
+				}
+			}
+			if group > 0 && 2*group+1 < len(groups) && groups[2*group] >= 0 {
+				start, end = start+groups[2*group], start+groups[2*group+1]
+			}
+		}
+	}
+	return f.StartLine, start, end, start < end
+}
+
+// envVarName derives an environment variable name from a rule ID
+func envVarName(ruleID string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, ruleID)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "SECRET_" + name
+	}
+	return name
+}
+
+// envName returns name, numbered if a variable of that name in the .env
+// content already holds another value, and whether it holds secret
+func envName(content, name, secret string) (string, bool) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+
+	candidate := name
+	for i := 2; ; i++ {
+		value, exists := values[candidate]
+		if !exists {
+			return candidate, false
+		}
+		if value == secret {
+			return candidate, true
+		}
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
+// envValue quotes a secret for a .env file when it would not be read back
+// as is. Single quotes keep it literal, as dotenv loaders and shells read
+// them without escapes or interpolation, so a secret containing one cannot
+// be written.
+func envValue(secret string) (string, bool) {
+	if strings.Contains(secret, "'") {
+		return "", false
+	}
+	if strings.ContainsAny(secret, " \t#\"`$\\") {
+		return "'" + secret + "'", true
+	}
+	return secret, true
+}
+
+// gitignoreMatches reports whether the .gitignore content ignores name in
+// its directory. Only patterns without a directory part are considered.
+func gitignoreMatches(content, name string) bool {
+	ignored := false
+	for _, line := range strings.Split(content, "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "!"), "/")
+		if matched, _ := path.Match(pattern, name); matched {
+			ignored = !negated
+		}
+	}
+	return ignored
+}
+
+// appendFileChanges returns the document changes that append text to the
+// file at uri, creating it if it does not exist
+func (s *Server) appendFileChanges(uri protocol.DocumentUri, text string) []any {
+	content, exists := s.documentContent(uri)
+	if !exists {
+		ignoreIfExists := true
+		return []any{
+			protocol.CreateFile{
+				Kind:    "create",
+				URI:     uri,
+				Options: &protocol.CreateFileOptions{IgnoreIfExists: &ignoreIfExists},
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				},
+				Edits: []any{protocol.TextEdit{NewText: text}},
+			},
+		}
+	}
+
+	// Keep the existing last line intact
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		text = "\n" + text
+	}
+
+	end := NewTextBuffer(content).End()
+	return []any{
+		protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			},
+			Edits: []any{protocol.TextEdit{Range: protocol.Range{Start: end, End: end}, NewText: text}},
+		},
+	}
+}
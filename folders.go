@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// WorkspaceFolder is one root folder of the workspace. Every folder has its
+// own .gitleaks.toml, .gitleaksignore and baseline, and so its own config,
+// scanners, cache and watchers. Nested projects may carry their own
+// .gitleaks.toml and .gitleaksignore; the nearest ones apply to a file.
+type WorkspaceFolder struct {
+	URI  protocol.DocumentUri // empty for a server without workspace folders
+	Name string
+
+	mu       sync.RWMutex
+	config   *Config                 // config of the folder root
+	configs  map[string]*Config      // configs of nested projects by path
+	scanners map[scannerKey]*Scanner // created on first use
+	resolved map[string]scannerKey   // resolve results by directory
+	cache    *Cache
+	watcher  *fsnotify.Watcher // watches for ignore files and the baseline
+	ctx      context.Context   // set by start, nil if nothing is watched
+	cancel   context.CancelFunc
+
+	onReload     func() // called after a watcher dropped scanners
+	loggedSource string // config source last reported by logConfigSources
+}
+
+// scannerKey identifies the config and ignore file that apply to a
+// directory. Directories with the same key share a scanner.
+type scannerKey struct {
+	configPath string // "" for the default config
+	ignorePath string // "" for none
+}
+
+// NewWorkspaceFolder loads the configuration of the folder at rootPath; an
+// empty rootPath uses the default config. onReload, which may be nil, is
+// called whenever a watcher drops scanners.
+func NewWorkspaceFolder(rootPath, name string, settings *ServerSettings, onReload func()) (*WorkspaceFolder, error) {
+	f := &WorkspaceFolder{
+		Name:     name,
+		configs:  make(map[string]*Config),
+		scanners: make(map[scannerKey]*Scanner),
+		resolved: make(map[string]scannerKey),
+		cache:    NewCache(),
+		onReload: onReload,
+	}
+	if rootPath != "" {
+		f.URI = pathToURI(rootPath)
+	}
+
+	cfg, err := NewConfig(rootPath, settings, func() {
+		slog.Info("reloading configuration, clearing cache", "folder", f.Name)
+		f.reload(f.config.Path())
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.config = cfg
+	return f, nil
+}
+
+// rootPath returns the folder's directory, or "" if it has none
+func (f *WorkspaceFolder) rootPath() string {
+	return f.config.rootPath
+}
+
+// contains reports whether path is inside the folder
+func (f *WorkspaceFolder) contains(path string) bool {
+	if f.rootPath() == "" {
+		return false
+	}
+	_, ok := relativePath(f.rootPath(), path)
+	return ok
+}
+
+// resolve returns the nearest .gitleaks.toml and .gitleaksignore walking
+// up from dir to the folder root. Directories outside the folder use the
+// files of the root, and a config named by the configPath setting or the
+// environment applies to every directory. Results are kept until the
+// watcher sees a config or ignore file being added or removed.
+func (f *WorkspaceFolder) resolve(dir string) scannerKey {
+	rootPath := f.rootPath()
+	if rootPath == "" {
+		return scannerKey{configPath: f.config.Path()}
+	}
+	if !f.contains(dir) {
+		dir = rootPath
+	}
+
+	f.mu.RLock()
+	key, ok := f.resolved[dir]
+	f.mu.RUnlock()
+	if ok {
+		return key
+	}
+
+	key = scannerKey{ignorePath: findNearest(rootPath, dir, findIgnoreFile)}
+	if f.config.explicit() {
+		key.configPath = f.config.Path()
+	} else {
+		key.configPath = findNearest(rootPath, dir, findConfigFile)
+	}
+
+	f.mu.Lock()
+	f.resolved[dir] = key
+	f.mu.Unlock()
+	return key
+}
+
+// forgetResolved clears the results of resolve, e.g. after files were
+// added or removed in directories that are not watched
+func (f *WorkspaceFolder) forgetResolved() {
+	f.mu.Lock()
+	clear(f.resolved)
+	f.mu.Unlock()
+}
+
+// findNearest returns the first file found by find in dir or one of its
+// parents up to rootPath, or "" if there is none
+func findNearest(rootPath, dir string, find func(dir string) string) string {
+	for {
+		if path := find(dir); path != "" {
+			return path
+		}
+		if dir == rootPath || filepath.Dir(dir) == dir {
+			return ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// getScanner returns the scanner of the folder root
+func (f *WorkspaceFolder) getScanner() *Scanner {
+	return f.scanner(f.rootPath())
+}
+
+// scannerFor returns the scanner for the file at path
+func (f *WorkspaceFolder) scannerFor(path string) *Scanner {
+	return f.scanner(filepath.Dir(path))
+}
+
+// scanner returns the scanner for files in dir, creating it on first use
+// of the config and ignore file that apply there (thread-safe)
+func (f *WorkspaceFolder) scanner(dir string) *Scanner {
+	key := f.resolve(dir)
+
+	f.mu.RLock()
+	scanner, ok := f.scanners[key]
+	f.mu.RUnlock()
+	if ok {
+		return scanner
+	}
+
+	scanner = f.newScanner(key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.scanners[key]; ok {
+		return existing
+	}
+	f.scanners[key] = scanner
+	return scanner
+}
+
+// configFor returns the config loaded from path, loading and watching
+// the config of a nested project on first use
+func (f *WorkspaceFolder) configFor(path string) (*Config, error) {
+	if path == f.config.Path() {
+		return f.config, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.configs[path]; ok {
+		return c, nil
+	}
+
+	c, err := NewConfigAt(path, f.rootPath(), f.config.settings, func() {
+		slog.Info("reloading nested configuration", "folder", f.Name, "path", path)
+		f.reload(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("found nested gitleaks config", "folder", f.Name, "path", path)
+
+	if f.ctx != nil {
+		if err := c.Watch(f.ctx); err != nil {
+			slog.Error("failed to watch config", "path", path, "error", err)
+		}
+	}
+	f.configs[path] = c
+	return c, nil
+}
+
+// loadedConfigs returns the config of the folder root and those of the
+// nested projects loaded so far
+func (f *WorkspaceFolder) loadedConfigs() []*Config {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	configs := []*Config{f.config}
+	for _, c := range f.configs {
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// newScanner creates a scanner with the config and ignore file of key and
+// the baseline report of the folder
+func (f *WorkspaceFolder) newScanner(key scannerKey) *Scanner {
+	cfg, err := f.configFor(key.configPath)
+	if err != nil {
+		slog.Error("failed to load config, using the folder's", "path", key.configPath, "error", err)
+		cfg = f.config
+	}
+
+	scanner := NewScannerWithIgnore(cfg.GetConfig(), f.rootPath(), key.ignorePath)
+	scanner.SetRedact(f.config.settings.Redact())
+	if key.ignorePath != "" {
+		f.watchDir(filepath.Dir(key.ignorePath))
+	}
+
+	if path := f.config.BaselinePath(); path != "" {
+		if err := scanner.LoadBaseline(path); err != nil {
+			slog.Warn("failed to load baseline", "path", path, "error", err)
+		}
+		f.watchDir(filepath.Dir(path))
+	}
+	return scanner
+}
+
+// dropScanners forgets the scanners that depend on the file at path, or
+// all scanners if path is "", and clears the cache and the results of
+// resolve. They are recreated on next use.
+func (f *WorkspaceFolder) dropScanners(path string) {
+	f.mu.Lock()
+	clear(f.resolved)
+	for key := range f.scanners {
+		if path == "" || key.configPath == path || key.ignorePath == path {
+			delete(f.scanners, key)
+		}
+	}
+	f.mu.Unlock()
+	f.cache.Clear()
+}
+
+// reload drops the scanners that depend on a watched file after it
+// changed, see dropScanners
+func (f *WorkspaceFolder) reload(path string) {
+	f.dropScanners(path)
+	if f.onReload != nil {
+		f.onReload()
+	}
+}
+
+// start watches the folder's config, ignore files and baseline until ctx
+// is done or the folder is closed
+func (f *WorkspaceFolder) start(ctx context.Context) {
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.ctx = ctx
+
+	// Start watching the config file and the files it extends
+	if err := f.config.Watch(ctx); err != nil {
+		slog.Error("failed to watch config", "folder", f.Name, "error", err)
+	}
+
+	// Watch for the ignore file and baseline even if they do not exist yet,
+	// so that one created by the "add to .gitleaksignore" action is picked up
+	if f.rootPath() != "" {
+		if err := f.watchFiles(ctx); err != nil {
+			slog.Error("failed to watch workspace files", "folder", f.Name, "error", err)
+		}
+	}
+}
+
+// close stops the folder's watchers
+func (f *WorkspaceFolder) close() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// watchFiles watches the folder for .gitleaksignore or the baseline report
+// being created, changed or removed, and for nested configs being created
+// or removed. The watch is registered before returning so that no change
+// made afterwards is missed. Directories of nested ignore files and open
+// documents are added by watchDir and watchDocument.
+func (f *WorkspaceFolder) watchFiles(ctx context.Context) error {
+	rootPath := f.rootPath()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating workspace watcher: %w", err)
+	}
+
+	// Watch the root directory rather than the files, which may not exist
+	if err := watcher.Add(rootPath); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watching directory %s: %w", rootPath, err)
+	}
+	f.mu.Lock()
+	f.watcher = watcher
+	f.mu.Unlock()
+
+	slog.Info("watching .gitleaksignore and baseline for changes", "root", rootPath)
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+				// A changed ignore file only affects the scanners using
+				// it, a changed baseline affects all of them
+				if filepath.Base(event.Name) == ".gitleaksignore" {
+					slog.Info("reloading scanners", "path", event.Name)
+					f.reload(event.Name)
+				} else if f.baselineFile(event.Name) {
+					slog.Info("reloading scanners", "path", event.Name)
+					f.reload("")
+				} else if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 && f.nestedConfig(event.Name) {
+					// Changes to the file itself are seen by its Config
+					slog.Info("nested config added or removed", "path", event.Name)
+					if filepath.Base(event.Name) == ".gitleaks" && event.Op&fsnotify.Create != 0 {
+						f.watchDir(event.Name)
+					}
+					f.forgetResolved()
+					if f.onReload != nil {
+						f.onReload()
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("workspace watcher error", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchDir adds a directory of a nested ignore file or a baseline report
+// to the watcher
+func (f *WorkspaceFolder) watchDir(dir string) {
+	f.mu.RLock()
+	watcher := f.watcher
+	f.mu.RUnlock()
+
+	if watcher == nil || dir == f.rootPath() {
+		return
+	}
+	if err := watcher.Add(dir); err != nil {
+		slog.Warn("failed to watch directory", "dir", dir, "error", err)
+	}
+}
+
+// watchDocument adds the directory of an open document and its parents up
+// to the folder root to the watcher, so that configs and ignore files
+// created next to it are picked up
+func (f *WorkspaceFolder) watchDocument(path string) {
+	if !f.contains(path) {
+		return
+	}
+	for dir := filepath.Dir(path); dir != f.rootPath() && filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+		f.watchDir(dir)
+	}
+}
+
+// nestedConfig reports whether path is one of configNames, or a directory
+// containing one, below the folder root. The root config is watched by
+// the folder's Config.
+func (f *WorkspaceFolder) nestedConfig(path string) bool {
+	for _, name := range configNames {
+		dir, ok := strings.CutSuffix(path, string(filepath.Separator)+name)
+		if !ok && filepath.Dir(name) != "." {
+			dir, ok = strings.CutSuffix(path, string(filepath.Separator)+filepath.Dir(name))
+		}
+		if ok && dir != f.rootPath() && f.contains(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// baselineFile reports whether path is a baseline report of the folder
+func (f *WorkspaceFolder) baselineFile(path string) bool {
+	if filepath.Dir(path) == f.rootPath() && slices.Contains(baselineNames, filepath.Base(path)) {
+		return true
+	}
+	return path == f.config.BaselinePath()
+}
+
+// getFolders returns the workspace folders (thread-safe)
+func (s *Server) getFolders() []*WorkspaceFolder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.folders)
+}
+
+// folderFor returns the folder whose scanner handles uri: the innermost
+// folder containing it, or else the first folder, whose config then
+// applies to files outside the workspace
+func (s *Server) folderFor(uri protocol.DocumentUri) *WorkspaceFolder {
+	path := uriToPath(uri)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best *WorkspaceFolder
+	for _, f := range s.folders {
+		if f.contains(path) && (best == nil || len(f.rootPath()) > len(best.rootPath())) {
+			best = f
+		}
+	}
+	if best == nil && len(s.folders) > 0 {
+		best = s.folders[0]
+	}
+	return best
+}
+
+// rootFolders returns the folders with a directory that are not nested in
+// another folder. Scanning them covers the whole workspace once.
+func (s *Server) rootFolders() []*WorkspaceFolder {
+	folders := s.getFolders()
+
+	var roots []*WorkspaceFolder
+	for _, f := range folders {
+		if f.rootPath() == "" {
+			continue
+		}
+		nested := slices.ContainsFunc(folders, func(other *WorkspaceFolder) bool {
+			return other != f && other.contains(f.rootPath()) && other.rootPath() != f.rootPath()
+		})
+		if !nested {
+			roots = append(roots, f)
+		}
+	}
+	return roots
+}
+
+// addFolder loads and starts watching a workspace folder
+func (s *Server) addFolder(folder protocol.WorkspaceFolder) error {
+	rootPath := uriToPath(folder.URI)
+
+	f, err := NewWorkspaceFolder(rootPath, folder.Name, s.settings, func() {
+		if client := s.getClient(); client != nil {
+			s.republishDiagnostics(client)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("loading workspace folder %s: %w", folder.Name, err)
+	}
+	f.start(s.ctx)
+
+	s.mu.Lock()
+	s.folders = append(s.folders, f)
+	s.mu.Unlock()
+
+	slog.Info("added workspace folder", "name", folder.Name, "root", rootPath)
+	return nil
+}
+
+// removeFolder stops watching a workspace folder and forgets it
+func (s *Server) removeFolder(uri protocol.DocumentUri) {
+	path := uriToPath(uri)
+
+	s.mu.Lock()
+	var removed []*WorkspaceFolder
+	s.folders = slices.DeleteFunc(s.folders, func(f *WorkspaceFolder) bool {
+		if f.rootPath() == path {
+			removed = append(removed, f)
+			return true
+		}
+		return false
+	})
+	s.mu.Unlock()
+
+	for _, f := range removed {
+		f.close()
+		slog.Info("removed workspace folder", "name", f.Name, "root", path)
+	}
+}
+
+// workspaceFolders returns the folders of the workspace opened by
+// initialize: WorkspaceFolders if the client sent them, otherwise the
+// single rootUri or rootPath
+func workspaceFolders(params *protocol.InitializeParams) []protocol.WorkspaceFolder {
+	if len(params.WorkspaceFolders) > 0 {
+		return params.WorkspaceFolders
+	}
+
+	rootPath := ""
+	if params.RootPath != nil {
+		rootPath = *params.RootPath
+	} else if params.RootURI != nil {
+		rootPath = uriToPath(*params.RootURI)
+	}
+	if rootPath == "" {
+		return nil
+	}
+	return []protocol.WorkspaceFolder{{URI: pathToURI(rootPath), Name: filepath.Base(rootPath)}}
+}
+
+func (s *Server) workspaceDidChangeWorkspaceFolders(context *glsp.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
+	slog.Debug("workspace folders changed",
+		"added", len(params.Event.Added),
+		"removed", len(params.Event.Removed))
+
+	for _, folder := range params.Event.Removed {
+		s.removeFolder(folder.URI)
+	}
+
+	// Real folders replace the stand-in of a workspace without folders
+	if len(params.Event.Added) > 0 {
+		s.removeFolder("")
+	}
+	for _, folder := range params.Event.Added {
+		if err := s.addFolder(folder); err != nil {
+			slog.Error("failed to add workspace folder", "uri", folder.URI, "error", err)
+		}
+	}
+
+	// A workspace without folders still scans open files with the defaults
+	if len(s.getFolders()) == 0 {
+		if err := s.addFolder(protocol.WorkspaceFolder{}); err != nil {
+			return err
+		}
+	}
+
+	// Open documents may now belong to another folder
+	s.republishDiagnostics(context)
+	return nil
+}
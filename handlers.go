@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -16,25 +16,107 @@ import (
 // Server holds the language server state
 type Server struct {
 	mu        sync.RWMutex
-	scanner   *Scanner
+	folders   []*WorkspaceFolder // at least one once initialized
 	documents *DocumentStore
-	config    *Config
-	cache     *Cache
+	settings  *ServerSettings
+	scheduler *ScanScheduler
+	ctx       context.Context // cancelled on shutdown or re-initialization
 	cancel    context.CancelFunc
+
+	// supportsConfiguration is set when the client advertises
+	// workspace/configuration, so settings can be pulled on demand
+	supportsConfiguration bool
+
+	// pullDiagnostics is set when the client supports textDocument/diagnostic;
+	// diagnostics are then pulled by the client instead of pushed
+	pullDiagnostics bool
+	// diagnosticRefresh is set when the client supports workspace/diagnostic/refresh
+	diagnosticRefresh bool
+
+	workspaceResult *WorkspaceScanResult // last workspace scan, served to workspace/diagnostic
+
+	stagedResult *WorkspaceScanResult // last staged scan, merged into diagnostics
+
+	configURIs map[protocol.DocumentUri]struct{} // configs with problems last published
+
+	failedConfigs map[*Config]struct{} // configs that failed to load, already reported
+
+	// reports are the files written by exportReport, which are left out
+	// of workspace scans
+	reports map[string]struct{}
+
+	trace protocol.TraceValue // trace level set by this connection's client
+
+	// client is the context of the initialize request, used to reach the
+	// client from file watchers that run outside any request
+	client *glsp.Context
+
+	handler *protocol.Handler // LSP handlers bound to this server
+}
+
+// getClient returns the context used to notify the client (thread-safe)
+func (s *Server) getClient() *glsp.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.client
 }
 
-// getScanner returns the current scanner (thread-safe)
-func (s *Server) getScanner() *Scanner {
+// setClient records the context used to notify the client (thread-safe)
+func (s *Server) setClient(client *glsp.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = client
+}
+
+// getWorkspaceResult returns the last workspace scan result (thread-safe)
+func (s *Server) getWorkspaceResult() *WorkspaceScanResult {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.scanner
+	return s.workspaceResult
 }
 
-// setScanner replaces the current scanner (thread-safe)
-func (s *Server) setScanner(scanner *Scanner) {
+// setWorkspaceResult records the last workspace scan result (thread-safe)
+func (s *Server) setWorkspaceResult(result *WorkspaceScanResult) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.scanner = scanner
+	s.workspaceResult = result
+}
+
+// getStagedResult returns the last staged scan result (thread-safe)
+func (s *Server) getStagedResult() *WorkspaceScanResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stagedResult
+}
+
+// findFinding resolves a finding by ID, looking first at the open document,
+// then at the last workspace scan (which also covers unopened files) and
+// the last staged scan
+func (s *Server) findFinding(uri protocol.DocumentUri, id string) (Finding, bool) {
+	if id == "" {
+		return Finding{}, false
+	}
+
+	if doc, ok := s.documents.Get(uri); ok {
+		for _, f := range doc.Findings {
+			if f.ID == id {
+				return f, true
+			}
+		}
+	}
+
+	for _, result := range []*WorkspaceScanResult{s.getWorkspaceResult(), s.getStagedResult()} {
+		if result == nil {
+			continue
+		}
+		for _, f := range result.Findings[uri] {
+			if f.ID == id {
+				return f, true
+			}
+		}
+	}
+
+	return Finding{}, false
 }
 
 // DocumentStore tracks open documents and their diagnostics
@@ -46,12 +128,19 @@ type DocumentStore struct {
 // Document represents an open file
 type Document struct {
 	URI         protocol.DocumentUri
+	LanguageID  string // as sent by didOpen, "" if unknown
 	Version     int32
 	Content     string
 	Diagnostics []protocol.Diagnostic
 	Findings    []Finding // Store findings for hover support
+
+	buffer *TextBuffer // line index used to apply incremental edits
 }
 
+// errStaleVersion is returned when a change arrives with a version that is
+// not newer than the stored document
+var errStaleVersion = errors.New("stale document version")
+
 // NewDocumentStore creates a new document store
 func NewDocumentStore() *DocumentStore {
 	return &DocumentStore{
@@ -61,16 +150,58 @@ func NewDocumentStore() *DocumentStore {
 
 // Set stores or updates a document
 func (ds *DocumentStore) Set(uri protocol.DocumentUri, version int32, content string) {
+	ds.Open(uri, "", version, content)
+}
+
+// Open stores a document opened with the given languageId
+func (ds *DocumentStore) Open(uri protocol.DocumentUri, languageID string, version int32, content string) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
 	ds.documents[uri] = &Document{
-		URI:     uri,
-		Version: version,
-		Content: content,
+		URI:        uri,
+		LanguageID: languageID,
+		Version:    version,
+		Content:    content,
+		buffer:     NewTextBuffer(content),
 	}
 }
 
+// ApplyChanges applies didChange content changes (ranged or whole) in order
+// and returns the resulting content. Changes for unknown documents or with
+// a version not newer than the stored one are rejected.
+func (ds *DocumentStore) ApplyChanges(uri protocol.DocumentUri, version int32, changes []any) (string, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	doc, ok := ds.documents[uri]
+	if !ok {
+		return "", fmt.Errorf("document not open: %s", uri)
+	}
+	if version <= doc.Version {
+		return "", fmt.Errorf("%w: got %d, have %d", errStaleVersion, version, doc.Version)
+	}
+
+	for _, change := range changes {
+		switch change := change.(type) {
+		case protocol.TextDocumentContentChangeEvent:
+			if change.Range == nil {
+				doc.buffer.Replace(change.Text)
+			} else {
+				doc.buffer.Apply(*change.Range, change.Text)
+			}
+		case protocol.TextDocumentContentChangeEventWhole:
+			doc.buffer.Replace(change.Text)
+		default:
+			return "", fmt.Errorf("unexpected content change type %T", change)
+		}
+	}
+
+	doc.Version = version
+	doc.Content = doc.buffer.String()
+	return doc.Content, nil
+}
+
 // Get retrieves a snapshot of a document (returns by value for thread safety)
 func (ds *DocumentStore) Get(uri protocol.DocumentUri) (Document, bool) {
 	ds.mu.RLock()
@@ -83,15 +214,20 @@ func (ds *DocumentStore) Get(uri protocol.DocumentUri) (Document, bool) {
 	return *doc, ok
 }
 
-// SetDiagnostics atomically updates diagnostics and findings for a document
-func (ds *DocumentStore) SetDiagnostics(uri protocol.DocumentUri, diagnostics []protocol.Diagnostic, findings []Finding) {
+// SetDiagnostics atomically updates diagnostics and findings for a document.
+// Results computed for an older version are discarded; returns false if the
+// document is closed or has changed since.
+func (ds *DocumentStore) SetDiagnostics(uri protocol.DocumentUri, version int32, diagnostics []protocol.Diagnostic, findings []Finding) bool {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	if doc, ok := ds.documents[uri]; ok {
-		doc.Diagnostics = diagnostics
-		doc.Findings = findings
+	doc, ok := ds.documents[uri]
+	if !ok || doc.Version != version {
+		return false
 	}
+	doc.Diagnostics = diagnostics
+	doc.Findings = findings
+	return true
 }
 
 // Delete removes a document
@@ -102,64 +238,107 @@ func (ds *DocumentStore) Delete(uri protocol.DocumentUri) {
 	delete(ds.documents, uri)
 }
 
-// Global server instance
-var globalServer *Server
+// All returns snapshots of every open document
+func (ds *DocumentStore) All() []Document {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
 
-func SetupServer(rootPath string) error {
-	// Cancel previous watchers if re-initializing
-	if globalServer != nil && globalServer.cancel != nil {
-		globalServer.cancel()
+	docs := make([]Document, 0, len(ds.documents))
+	for _, doc := range ds.documents {
+		docs = append(docs, *doc)
 	}
+	return docs
+}
 
-	cache := NewCache()
-	ctx, cancel := context.WithCancel(context.Background())
+// SetupServer creates a server for a workspace with the single folder
+// rootPath, or without folders if it is empty. The caller stops it with
+// Close.
+func SetupServer(rootPath string) (*Server, error) {
+	var folders []protocol.WorkspaceFolder
+	if rootPath != "" {
+		folders = []protocol.WorkspaceFolder{{URI: pathToURI(rootPath), Name: filepath.Base(rootPath)}}
+	}
 
-	// Check for .gitleaksignore file
-	ignoreFilePath := findIgnoreFile(rootPath)
+	s := NewServer()
+	if err := s.setup(folders); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
-	cfg, err := NewConfig(rootPath, func() {
-		slog.Info("reloading configuration, clearing cache")
-		if globalServer != nil {
-			if globalServer.config != nil {
-				// Recreate scanner with ignore file on reload
-				ignoreFile := findIgnoreFile(rootPath)
-				newScanner := NewScannerWithIgnore(globalServer.config.GetConfig(), ignoreFile)
-				globalServer.setScanner(newScanner)
-			}
-			// Clear cache on config reload
-			globalServer.cache.Clear()
-		}
-	})
-	if err != nil {
-		cancel()
-		return err
+// NewServer creates the state of one client connection. The workspace is
+// set up when the client sends initialize.
+func NewServer() *Server {
+	s := &Server{
+		documents: NewDocumentStore(),
+		settings:  NewServerSettings(),
+		trace:     protocol.TraceValueOff,
+	}
+	s.handler = &protocol.Handler{
+		Initialize:  s.initialize,
+		Initialized: s.initialized,
+		Shutdown:    s.shutdown,
+		SetTrace:    s.setTrace,
+		// Register document handlers
+		TextDocumentDidOpen:   s.textDocumentDidOpen,
+		TextDocumentDidChange: s.textDocumentDidChange,
+		TextDocumentDidSave:   s.textDocumentDidSave,
+		TextDocumentDidClose:  s.textDocumentDidClose,
+		// Register feature handlers
+		TextDocumentHover:      s.textDocumentHover,
+		TextDocumentCodeAction: s.textDocumentCodeAction,
+		TextDocumentCompletion: s.textDocumentCompletion,
+		// Register workspace handlers
+		WorkspaceDidChangeConfiguration:    s.workspaceDidChangeConfiguration,
+		WorkspaceDidChangeWorkspaceFolders: s.workspaceDidChangeWorkspaceFolders,
+		WorkspaceExecuteCommand:            s.executeCommand,
 	}
+	return s
+}
 
-	scanner := NewScannerWithIgnore(cfg.GetConfig(), ignoreFilePath)
+// Handler returns the LSP handler bound to this server; pullHandler adds
+// the 3.17 diagnostic requests
+func (s *Server) Handler() glsp.Handler {
+	return pullHandler{Handler: s.handler, server: s}
+}
 
-	globalServer = &Server{
-		scanner:   scanner,
-		documents: NewDocumentStore(),
-		config:    cfg,
-		cache:     cache,
-		cancel:    cancel,
+// setup loads the configuration of every workspace folder and starts
+// watching them, replacing the workspace of a previous initialize. Without
+// folders open files are scanned with the default config.
+func (s *Server) setup(folders []protocol.WorkspaceFolder) error {
+	// Cancel previous watchers if re-initializing
+	if s.cancel != nil {
+		s.cancel()
 	}
 
-	// Start watching config file
-	go func() {
-		if err := cfg.Watch(ctx); err != nil {
-			slog.Error("failed to watch config", "error", err)
-		}
-	}()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.scheduler = NewScanScheduler(s.ctx)
+
+	s.mu.Lock()
+	s.folders = nil
+	s.mu.Unlock()
 
-	// Start watching ignore file if it exists
-	if ignoreFilePath != "" {
-		go watchIgnoreFile(ctx, rootPath, ignoreFilePath)
+	if len(folders) == 0 {
+		folders = []protocol.WorkspaceFolder{{}}
+	}
+	for _, folder := range folders {
+		if err := s.addFolder(folder); err != nil {
+			s.cancel()
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Close stops the watchers and pending scans of the server, e.g. when its
+// client disconnects without a shutdown request
+func (s *Server) Close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
 // findIgnoreFile looks for .gitleaksignore in workspace root
 func findIgnoreFile(rootPath string) string {
 	if rootPath == "" {
@@ -172,54 +351,7 @@ func findIgnoreFile(rootPath string) string {
 	return ""
 }
 
-// watchIgnoreFile watches .gitleaksignore for changes
-func watchIgnoreFile(ctx context.Context, rootPath, ignoreFilePath string) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		slog.Error("failed to create ignore file watcher", "error", err)
-		return
-	}
-	defer watcher.Close()
-
-	// Watch the directory containing the ignore file
-	dir := filepath.Dir(ignoreFilePath)
-	if err := watcher.Add(dir); err != nil {
-		slog.Error("failed to watch directory for ignore file", "error", err)
-		return
-	}
-
-	slog.Info("watching .gitleaksignore for changes", "path", ignoreFilePath)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-			// Check if it's the ignore file that changed
-			if filepath.Base(event.Name) == ".gitleaksignore" {
-				if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
-					slog.Info("reloading .gitleaksignore")
-					if globalServer != nil && globalServer.config != nil {
-						ignoreFile := findIgnoreFile(rootPath)
-						newScanner := NewScannerWithIgnore(globalServer.config.GetConfig(), ignoreFile)
-						globalServer.setScanner(newScanner)
-						globalServer.cache.Clear()
-					}
-				}
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			slog.Error("ignore file watcher error", "error", err)
-		}
-	}
-}
-
-func textDocumentDidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
+func (s *Server) textDocumentDidOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
 	uri := params.TextDocument.URI
 	content := params.TextDocument.Text
 	version := params.TextDocument.Version
@@ -227,72 +359,70 @@ func textDocumentDidOpen(context *glsp.Context, params *protocol.DidOpenTextDocu
 	slog.Debug("document opened", "uri", uri)
 
 	// Store document
-	globalServer.documents.Set(uri, version, content)
+	s.documents.Open(uri, params.TextDocument.LanguageID, version, content)
+
+	// Watch for configs and ignore files created next to it
+	if f := s.folderFor(uri); f != nil {
+		f.watchDocument(uriToPath(uri))
+	}
 
 	// Scan and publish diagnostics
-	return scanAndPublish(context, uri, content)
+	return s.scanAndPublish(s.ctx, context, uri, version, content)
 }
 
-func textDocumentDidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
+func (s *Server) textDocumentDidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
 	uri := params.TextDocument.URI
 
-	// We use Full sync, so there's only one change with the full content
 	if len(params.ContentChanges) == 0 {
 		return nil
 	}
 
-	var content string
-	switch change := params.ContentChanges[0].(type) {
-	case protocol.TextDocumentContentChangeEvent:
-		content = change.Text
-	case protocol.TextDocumentContentChangeEventWhole:
-		content = change.Text
-	default:
-		slog.Error("unexpected content change type", "type", fmt.Sprintf("%T", params.ContentChanges[0]))
-		return nil
-	}
-
 	version := params.TextDocument.Version
 
-	slog.Debug("document changed", "uri", uri)
+	slog.Debug("document changed", "uri", uri, "changes", len(params.ContentChanges))
 
-	// Update document
-	globalServer.documents.Set(uri, version, content)
+	// Apply incremental edits to the stored buffer
+	content, err := s.documents.ApplyChanges(uri, version, params.ContentChanges)
+	if err != nil {
+		slog.Warn("rejecting document change", "uri", uri, "version", version, "error", err)
+		return nil
+	}
 
-	// Scan on change to provide immediate feedback
-	return scanAndPublish(context, uri, content)
+	// Debounce scans while the user is typing
+	s.scheduleScan(context, uri, version, content)
+	return nil
 }
 
-func textDocumentDidSave(context *glsp.Context, params *protocol.DidSaveTextDocumentParams) error {
+func (s *Server) textDocumentDidSave(context *glsp.Context, params *protocol.DidSaveTextDocumentParams) error {
 	uri := params.TextDocument.URI
 
 	slog.Debug("document saved", "uri", uri)
 
-	// Get content
-	var content string
+	doc, ok := s.documents.Get(uri)
+	if !ok {
+		slog.Warn("document not found in store", "uri", uri)
+		return nil
+	}
+
+	// Get content, falling back to stored content
+	content := doc.Content
 	if params.Text != nil {
 		content = *params.Text
-	} else {
-		// Fallback to stored content
-		doc, ok := globalServer.documents.Get(uri)
-		if !ok {
-			slog.Warn("document not found in store", "uri", uri)
-			return nil
-		}
-		content = doc.Content
 	}
 
-	// Scan and publish diagnostics
-	return scanAndPublish(context, uri, content)
+	// Scan immediately; a pending debounced scan is redundant now
+	s.scheduler.Cancel(uri)
+	return s.scanAndPublish(s.ctx, context, uri, doc.Version, content)
 }
 
-func textDocumentDidClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
+func (s *Server) textDocumentDidClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
 	uri := params.TextDocument.URI
 
 	slog.Debug("document closed", "uri", uri)
 
-	// Remove document from store
-	globalServer.documents.Delete(uri)
+	// Remove document from store and drop any pending scan
+	s.scheduler.Cancel(uri)
+	s.documents.Delete(uri)
 
 	// Clear diagnostics
 	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
@@ -303,40 +433,143 @@ func textDocumentDidClose(context *glsp.Context, params *protocol.DidCloseTextDo
 	return nil
 }
 
-// scanAndPublish scans content and publishes diagnostics
-func scanAndPublish(glspContext *glsp.Context, uri protocol.DocumentUri, content string) error {
-	var findings []Finding
-	var err error
-	cacheHit := false
-
-	// Check cache first
-	if cached, ok := globalServer.cache.Get(content); ok {
-		findings = cached
-		cacheHit = true
-	} else {
-		// Scan for secrets using filesystem path for correct fingerprints
-		ctx := context.Background()
-		filename := uriToPath(uri)
-		findings, err = globalServer.getScanner().ScanContent(ctx, filename, content)
+func (s *Server) workspaceDidChangeConfiguration(context *glsp.Context, params *protocol.DidChangeConfigurationParams) error {
+	slog.Debug("configuration changed")
+
+	// Clients using the pull model send the notification without our
+	// section, as a hint to fetch settings via workspace/configuration
+	if settings, ok := params.Settings.(map[string]any); ok {
+		if _, present := settings["gitleaks"]; present {
+			if s.settings.Update(settings) {
+				s.republishDiagnostics(context)
+			}
+			return nil
+		}
+	}
+
+	if s.supportsConfiguration {
+		go s.fetchConfiguration(context)
+	}
+
+	return nil
+}
+
+// fetchConfiguration pulls the "gitleaks" settings section from the client
+// and republishes diagnostics if anything changed. It issues a request to
+// the client, so it must not be called synchronously from a handler.
+func (s *Server) fetchConfiguration(glspContext *glsp.Context) {
+	if glspContext.Call == nil {
+		return
+	}
+
+	section := "gitleaks"
+	params := protocol.ConfigurationParams{
+		Items: []protocol.ConfigurationItem{{Section: &section}},
+	}
+
+	var result []any
+	glspContext.Call(protocol.ServerWorkspaceConfiguration, params, &result)
+	if len(result) == 0 {
+		return
+	}
+
+	settings, ok := result[0].(map[string]any)
+	if !ok {
+		return
+	}
+
+	if s.settings.UpdateSection(settings) {
+		slog.Info("settings updated from client")
+		s.republishDiagnostics(glspContext)
+	}
+}
+
+// republishDiagnostics rescans every open document and publishes fresh
+// diagnostics, e.g. after a settings change
+func (s *Server) republishDiagnostics(glspContext *glsp.Context) {
+	// A changed configPath, baselinePath or redact setting needs new scanners
+	redact, redactChanged := s.settings.Redact(), false
+	for _, f := range s.getFolders() {
+		changed, err := f.config.Refresh()
 		if err != nil {
-			slog.Error("scan failed", "uri", uri, "error", err)
-			return err
+			slog.Error("failed to reload config", "folder", f.Name, "error", err)
+		}
+		scanner := f.getScanner()
+		if scanner.redact != redact {
+			redactChanged = true
+		}
+		if changed || redactChanged || scanner.baselinePath != f.config.BaselinePath() {
+			f.dropScanners("")
+		}
+	}
+
+	// Findings kept from scans with other redaction are forgotten
+	if redactChanged {
+		s.setWorkspaceResult(nil)
+	}
+
+	// Configs that failed to load are reported whether or not they are open
+	s.publishConfigDiagnostics(glspContext)
+
+	// A reload may have switched to another config
+	s.logConfigSources(glspContext)
+
+	// Pull-model clients fetch fresh diagnostics themselves
+	if s.pullDiagnostics {
+		s.requestDiagnosticRefresh(glspContext)
+		return
+	}
+
+	ctx := s.ctx
+	for _, doc := range s.documents.All() {
+		if err := s.scanAndPublish(ctx, glspContext, doc.URI, doc.Version, doc.Content); err != nil {
+			slog.Error("failed to republish diagnostics", "uri", doc.URI, "error", err)
 		}
-		// Store in cache
-		globalServer.cache.Put(content, findings)
+	}
+}
+
+// scheduleScan debounces a scan of the given document version
+func (s *Server) scheduleScan(glspContext *glsp.Context, uri protocol.DocumentUri, version int32, content string) {
+	s.scheduler.Schedule(uri, s.settings.DebounceDelay(), func(ctx context.Context) {
+		if err := s.scanAndPublish(ctx, glspContext, uri, version, content); err != nil {
+			slog.Error("debounced scan failed", "uri", uri, "error", err)
+		}
+	})
+}
+
+// scanAndPublish scans content and publishes diagnostics. Results are only
+// published if the document is still at the scanned version, and a scan
+// cancelled through ctx publishes nothing.
+func (s *Server) scanAndPublish(ctx context.Context, glspContext *glsp.Context, uri protocol.DocumentUri, version int32, content string) error {
+	findings, cacheHit, err := s.scanDocument(ctx, uri, content)
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Debug("scan cancelled", "uri", uri, "version", version)
+			return nil
+		}
+		slog.Error("scan failed", "uri", uri, "error", err)
+		return err
 	}
 
 	// Convert to diagnostics
-	diagnostics := FindingsToDiagnostics(findings)
+	diagnostics := s.documentDiagnostics(uri, content, findings)
 
 	// Store findings with diagnostics atomically for hover support
-	globalServer.documents.SetDiagnostics(uri, diagnostics, findings)
+	if !s.documents.SetDiagnostics(uri, version, diagnostics, findings) {
+		slog.Debug("discarding stale scan results", "uri", uri, "version", version)
+		return nil
+	}
 
 	slog.Debug("scan complete",
 		"uri", uri,
 		"findings", len(findings),
 		"cacheHit", cacheHit)
 
+	// Pull-model clients request diagnostics via textDocument/diagnostic
+	if s.pullDiagnostics {
+		return nil
+	}
+
 	// Publish diagnostics
 	glspContext.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
 		URI:         uri,
@@ -345,3 +578,29 @@ func scanAndPublish(glspContext *glsp.Context, uri protocol.DocumentUri, content
 
 	return nil
 }
+
+// scanDocument returns findings for content, using the cache when possible.
+// The document is scanned by the folder that contains it, with the config
+// and ignore file nearest to it.
+func (s *Server) scanDocument(ctx context.Context, uri protocol.DocumentUri, content string) ([]Finding, bool, error) {
+	filename := uriToPath(uri)
+	folder := s.folderFor(uri)
+	scanner := folder.scannerFor(filename)
+	key := scanner.cacheKey(content)
+
+	// Check cache first. Ignore file and baseline entries name the file,
+	// so they are applied after the findings are bound to it.
+	if cached, ok := folder.cache.Get(key); ok {
+		return scanner.Filter(rebindFindings(cached, folder.rootPath(), filename)), true, nil
+	}
+
+	// Scan for secrets using filesystem path for correct fingerprints
+	findings, err := scanner.Detect(ctx, filename, content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Store in cache, without the secrets if redaction is on
+	folder.cache.Put(key, scanner.cacheFindings(findings))
+	return scanner.Filter(findings), false, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/zricethezav/gitleaks/v8/cmd/scm"
+	"github.com/zricethezav/gitleaks/v8/detect"
+	"github.com/zricethezav/gitleaks/v8/report"
+	"github.com/zricethezav/gitleaks/v8/sources"
+)
+
+// HistoryScanResult contains the results of a git history scan
+type HistoryScanResult struct {
+	Range    string // Commit range passed to git log, empty for all history
+	Commits  int    // Commits with additions that were scanned
+	Findings []Finding
+}
+
+// HistoryFinding is a history finding as returned to the client. The secret
+// and match are left out since they may no longer exist in the working tree.
+type HistoryFinding struct {
+	RuleID      string `json:"ruleId"`
+	Description string `json:"description"`
+	File        string `json:"file"`
+	StartLine   int    `json:"startLine"`
+	Commit      string `json:"commit"`
+	Author      string `json:"author"`
+	Email       string `json:"email"`
+	Date        string `json:"date"`
+	Message     string `json:"message"`
+	Link        string `json:"link,omitempty"` // Commit link on the SCM platform of the remote
+	Fingerprint string `json:"fingerprint"`
+}
+
+// errInvalidCommitRange is returned for ranges that git log could take as options
+var errInvalidCommitRange = errors.New("invalid commit range")
+
+// ScanHistory scans the git history of the repository at rootPath, limited
+// to commitRange (e.g. "main..HEAD") if it is not empty. The ignore file and
+// baseline are applied like the CLI's git scan does.
+func (s *Server) ScanHistory(ctx context.Context, rootPath, commitRange string, progress *ProgressReporter) (*HistoryScanResult, error) {
+	if rootPath == "" {
+		return nil, nil
+	}
+	if err := validateCommitRange(commitRange); err != nil {
+		return nil, err
+	}
+
+	repoPath, err := gitTopLevel(ctx, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := countCommits(ctx, repoPath, commitRange)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("starting history scan",
+		"repo", repoPath,
+		"range", commitRange,
+		"commits", total)
+
+	detector := s.folderFor(pathToURI(rootPath)).newGitDetector(ctx, repoPath)
+
+	logOpts := ""
+	if commitRange != "" {
+		// Custom options replace gitleaks' defaults, so restate them
+		logOpts = "--full-history --diff-filter=tuxdb " + commitRange
+	}
+	cmd, err := sources.NewGitLogCmdContext(ctx, repoPath, logOpts)
+	if err != nil {
+		return nil, fmt.Errorf("running git log: %w", err)
+	}
+
+	source := &fragmentCounter{
+		Source: &sources.Git{
+			Cmd:    cmd,
+			Config: &detector.Config,
+			Remote: sources.NewRemoteInfoContext(ctx, scm.UnknownPlatform, repoPath),
+			Sema:   detector.Sema,
+		},
+		key: func(fragment sources.Fragment) string { return fragment.CommitSHA },
+		onNew: func(seen int) {
+			if progress != nil && total > 0 && seen%10 == 0 {
+				pct := uint32(min(float64(seen)/float64(total)*100, 100))
+				progress.Report(fmt.Sprintf("Scanning %d/%d commits", seen, total), pct)
+			}
+		},
+	}
+
+	gitleaksFindings, err := detector.DetectSource(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("scanning history: %w", err)
+	}
+
+	result := &HistoryScanResult{
+		Range:    commitRange,
+		Commits:  source.Seen(),
+		Findings: make([]Finding, 0, len(gitleaksFindings)),
+	}
+	for _, gf := range gitleaksFindings {
+		result.Findings = append(result.Findings, convertGitFinding(repoPath, gf))
+	}
+
+	slog.Info("history scan complete",
+		"commits", result.Commits,
+		"findings", len(result.Findings))
+
+	return result, nil
+}
+
+// newGitDetector creates a detector for git sources of the repository at
+// repoPath, with the folder's config, baseline and redaction and the
+// repository's ignore file applied like the CLI does
+func (f *WorkspaceFolder) newGitDetector(ctx context.Context, repoPath string) *detect.Detector {
+	detector := detect.NewDetectorContext(ctx, f.config.GetConfig())
+	detector.Redact = f.config.settings.Redact()
+	if ignoreFile := findIgnoreFile(repoPath); ignoreFile != "" {
+		if err := detector.AddGitleaksIgnore(ignoreFile); err != nil {
+			slog.Warn("failed to load .gitleaksignore", "path", ignoreFile, "error", err)
+		}
+	}
+	if baseline := f.config.BaselinePath(); baseline != "" {
+		if err := detector.AddBaseline(baseline, repoPath); err != nil {
+			slog.Warn("failed to load baseline", "path", baseline, "error", err)
+		}
+	}
+	return detector
+}
+
+// convertGitFinding converts a finding from a git source, whose paths are
+// relative to the repository and whose lines are 1-based. The fingerprint
+// computed by gitleaks is kept, as it includes the commit.
+func convertGitFinding(repoPath string, gf report.Finding) Finding {
+	gf.File = filepath.Join(repoPath, filepath.FromSlash(gf.File))
+	gf.StartLine--
+	gf.EndLine--
+	return convertGitleaksFinding(gf, gf.Fingerprint)
+}
+
+// fragmentCounter wraps a source and counts the distinct keys (commits or
+// files) of the fragments it yields
+type fragmentCounter struct {
+	sources.Source
+	key   func(sources.Fragment) string
+	onNew func(seen int)
+
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// Fragments yields the fragments of the wrapped source
+func (c *fragmentCounter) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return c.Source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if key := c.key(fragment); key != "" {
+			c.mu.Lock()
+			if c.keys == nil {
+				c.keys = make(map[string]struct{})
+			}
+			_, known := c.keys[key]
+			c.keys[key] = struct{}{}
+			seen := len(c.keys)
+			c.mu.Unlock()
+
+			if !known && c.onNew != nil {
+				c.onNew(seen)
+			}
+		}
+		return yield(fragment, err)
+	})
+}
+
+// Seen returns the number of distinct keys yielded so far
+func (c *fragmentCounter) Seen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keys)
+}
+
+// validateCommitRange rejects ranges that git would parse as options or
+// that gitleaks would split into several arguments
+func validateCommitRange(commitRange string) error {
+	if strings.HasPrefix(commitRange, "-") || strings.ContainsAny(commitRange, " \t\n") {
+		return fmt.Errorf("%w: %q", errInvalidCommitRange, commitRange)
+	}
+	return nil
+}
+
+// gitTopLevel returns the root of the git repository containing path
+func gitTopLevel(ctx context.Context, path string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git repository: %w", path, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// repositoryFolders returns one workspace folder per git repository, so
+// that folders sharing a repository are scanned once, with the config of
+// the first of them. Folders outside a repository are skipped; if no
+// folder is in one, the first error is returned.
+func (s *Server) repositoryFolders(ctx context.Context) ([]*WorkspaceFolder, error) {
+	var folders []*WorkspaceFolder
+	var firstErr error
+	repos := make(map[string]struct{})
+
+	for _, f := range s.getFolders() {
+		if f.rootPath() == "" {
+			continue
+		}
+		repo, err := gitTopLevel(ctx, f.rootPath())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if _, ok := repos[repo]; !ok {
+			repos[repo] = struct{}{}
+			folders = append(folders, f)
+		}
+	}
+
+	if len(folders) == 0 {
+		return nil, firstErr
+	}
+	return folders, nil
+}
+
+// countCommits returns the number of commits in commitRange, or in all of
+// the history if it is empty
+func countCommits(ctx context.Context, repoPath, commitRange string) (int, error) {
+	args := []string{"-C", repoPath, "rev-list", "--count"}
+	if commitRange != "" {
+		args = append(args, commitRange, "--")
+	} else {
+		args = append(args, "--all")
+	}
+
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("counting commits: %w", err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// toHistoryFinding converts a finding for the command result
+func toHistoryFinding(f Finding) HistoryFinding {
+	return HistoryFinding{
+		RuleID:      f.RuleID,
+		Description: f.Description,
+		File:        f.File,
+		StartLine:   f.StartLine + 1,
+		Commit:      f.Commit,
+		Author:      f.Author,
+		Email:       f.Email,
+		Date:        f.Date,
+		Message:     f.Message,
+		Link:        f.Link,
+		Fingerprint: f.Fingerprint,
+	}
+}
+
+// handleScanHistoryCommand handles the scanHistory command. An optional
+// first argument limits the scan to a commit range, e.g. "main..HEAD".
+func (s *Server) handleScanHistoryCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	commitRange := ""
+	if len(params.Arguments) > 0 {
+		arg, ok := params.Arguments[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected a string, got %T", errInvalidCommitRange, params.Arguments[0])
+		}
+		commitRange = arg
+	}
+
+	progress := NewProgressReporter(ctx, "Scanning git history for secrets")
+
+	folders, err := s.repositoryFolders(s.ctx)
+	if err != nil {
+		progress.End("Scan failed")
+		slog.Error("history scan failed", "error", err)
+		return nil, err
+	}
+	if len(folders) == 0 {
+		progress.End("No workspace to scan")
+		return nil, nil
+	}
+
+	commits := 0
+	findings := []HistoryFinding{}
+	for _, folder := range folders {
+		result, err := s.ScanHistory(s.ctx, folder.rootPath(), commitRange, progress)
+		if err != nil {
+			progress.End("Scan failed")
+			slog.Error("history scan failed", "folder", folder.Name, "error", err)
+			return nil, err
+		}
+		commits += result.Commits
+		for _, f := range result.Findings {
+			findings = append(findings, toHistoryFinding(f))
+		}
+	}
+
+	progress.End(fmt.Sprintf("Found %d secrets in %d commits", len(findings), commits))
+
+	return map[string]any{
+		"range":         commitRange,
+		"commits":       commits,
+		"totalFindings": len(findings),
+		"findings":      findings,
+	}, nil
+}
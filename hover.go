@@ -2,39 +2,30 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
-func textDocumentHover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+func (s *Server) textDocumentHover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
 	uri := params.TextDocument.URI
 	position := params.Position
 
-	// Get document snapshot
-	doc, ok := globalServer.documents.Get(uri)
+	finding, ok := s.findingAtPosition(uri, position)
 	if !ok {
-		return nil, nil
-	}
-
-	// Find diagnostic at cursor position
-	var finding *Finding
-	for i, diag := range doc.Diagnostics {
-		if positionInRange(position, diag.Range) {
-			if i < len(doc.Findings) {
-				finding = &doc.Findings[i]
-				break
+		// Keys of a gitleaks config are documented
+		if s.isConfigDocument(uri) {
+			if content, ok := s.documentContent(uri); ok {
+				return configHover(content, position), nil
 			}
 		}
-	}
-
-	if finding == nil {
 		return nil, nil
 	}
 
 	// Format hover content
-	content := formatHoverContent(*finding)
+	content := formatHoverContent(finding)
 
 	return &protocol.Hover{
 		Contents: protocol.MarkupContent{
@@ -44,6 +35,35 @@ func textDocumentHover(context *glsp.Context, params *protocol.HoverParams) (*pr
 	}, nil
 }
 
+// findingAtPosition resolves the finding under the cursor. Diagnostics of
+// the open document are searched first; for files that are not open the
+// findings of the last workspace scan are used. The findings of the last
+// staged scan follow, as in findFinding.
+func (s *Server) findingAtPosition(uri protocol.DocumentUri, position protocol.Position) (Finding, bool) {
+	var (
+		diagnostics []protocol.Diagnostic
+		findings    []Finding
+	)
+	if doc, ok := s.documents.Get(uri); ok {
+		diagnostics, findings = slices.Clip(doc.Diagnostics), doc.Findings
+	} else if result := s.getWorkspaceResult(); result != nil {
+		findings = result.Findings[uri]
+		diagnostics = s.diagnostics(findings)
+	}
+	diagnostics = s.withStagedDiagnostics(uri, diagnostics, findings)
+
+	for _, diag := range diagnostics {
+		if !positionInRange(position, diag.Range) {
+			continue
+		}
+		if finding, ok := s.findFinding(uri, findingIDFromDiagnostic(diag)); ok {
+			return finding, true
+		}
+	}
+
+	return Finding{}, false
+}
+
 // positionInRange checks if a position is within a range
 func positionInRange(pos protocol.Position, rng protocol.Range) bool {
 	// Check if position is after range start
@@ -110,7 +130,7 @@ func formatHoverContent(f Finding) string {
 	sb.WriteString("```go\n")
 	sb.WriteString("// gitleaks:allow\n")
 	sb.WriteString("```\n\n")
-	sb.WriteString("Or add the fingerprint to `.gitleaksignore`:\n")
+	sb.WriteString("Or add this line to `.gitleaksignore`:\n")
 	fmt.Fprintf(&sb, "```\n%s\n```\n", f.Fingerprint)
 
 	return sb.String()
@@ -19,8 +19,10 @@ func TestMemoryLeak(t *testing.T) {
 	// Silence logs during test
 	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	err := SetupServer("")
+	s, err := SetupServer("")
 	require.NoError(t, err)
+	defer s.Close()
+	folder := s.getFolders()[0]
 
 	// Content samples of varying sizes
 	smallContent := `package main
@@ -46,20 +48,20 @@ func main() {}
 		uri := "file:///test/file.go"
 
 		// Scan (simulates didOpen/didChange)
-		findings, err := globalServer.scanner.ScanContent(ctx, uri, content)
+		findings, err := folder.getScanner().ScanContent(ctx, uri, content)
 		require.NoError(t, err)
 
 		// Store in cache (simulates normal operation)
-		globalServer.cache.Put(content, findings)
+		folder.cache.Put(content, findings)
 
 		// Every 100 iterations, also test cache retrieval
 		if i%100 == 0 {
-			globalServer.cache.Get(content)
+			folder.cache.Get(content)
 		}
 
 		// Every 200 iterations, clear cache (simulates config reload)
 		if i%200 == 0 {
-			globalServer.cache.Clear()
+			folder.cache.Clear()
 		}
 	}
 
@@ -97,8 +99,10 @@ func main() {}
 func TestMemoryLeakWorkspaceScan(t *testing.T) {
 	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	err := SetupServer("")
+	s, err := SetupServer("")
 	require.NoError(t, err)
+	defer s.Close()
+	folder := s.getFolders()[0]
 
 	// Create temp workspace with 50 files
 	tmpDir := t.TempDir()
@@ -116,12 +120,12 @@ func TestMemoryLeakWorkspaceScan(t *testing.T) {
 
 	// Run workspace scan multiple times
 	for i := 0; i < 10; i++ {
-		result, err := globalServer.ScanWorkspace(ctx, tmpDir, nil)
+		result, err := s.ScanWorkspace(ctx, tmpDir, nil)
 		require.NoError(t, err)
 		require.NotNil(t, result)
 
 		// Clear between scans
-		globalServer.cache.Clear()
+		folder.cache.Clear()
 	}
 
 	runtime.GC()
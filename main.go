@@ -1,66 +1,61 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
-	"github.com/tliron/glsp/server"
 
 	_ "github.com/tliron/commonlog/simple"
 )
 
 const lsName = "gitleaks-ls"
 
-var (
-	version = "0.1.0"
-	handler protocol.Handler
-)
+var version = "0.1.0"
 
 func main() {
+	// Subcommands run without an LSP client
+	if code, ok := runCLI(os.Args[1:], os.Stdout, os.Stderr); ok {
+		os.Exit(code)
+	}
+
+	listen := flag.String("listen", "", "serve on tcp:host:port, unix:/path or ws:host:port instead of stdio")
+	stdio := flag.Bool("stdio", false, "serve over stdio (the default); overrides --listen")
+	flag.Parse()
+
+	// Editors pass --stdio for the transport they start the server with
+	if *stdio {
+		*listen = ""
+	}
+
 	// Setup logging
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
 	slog.SetDefault(logger)
 
-	// Create LSP handler
-	handler = protocol.Handler{
-		Initialize:  initialize,
-		Initialized: initialized,
-		Shutdown:    shutdown,
-		SetTrace:    setTrace,
-		// Register document handlers
-		TextDocumentDidOpen:   textDocumentDidOpen,
-		TextDocumentDidChange: textDocumentDidChange,
-		TextDocumentDidSave:   textDocumentDidSave,
-		TextDocumentDidClose:  textDocumentDidClose,
-		// Register feature handlers
-		TextDocumentHover:      textDocumentHover,
-		TextDocumentCodeAction: textDocumentCodeAction,
-		// Register command handler
-		WorkspaceExecuteCommand: executeCommand,
-	}
-
-	// Create LSP server
-	glspServer := server.NewServer(&handler, lsName, false)
-
-	// Run server over stdio
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	slog.Info("starting gitleaks language server", "version", version)
-	if err := glspServer.RunStdio(); err != nil {
+	if err := serve(ctx, *listen); err != nil {
 		slog.Error("server error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func initialize(context *glsp.Context, params *protocol.InitializeParams) (any, error) {
-	capabilities := handler.CreateServerCapabilities()
+func (s *Server) initialize(context *glsp.Context, params *protocol.InitializeParams) (any, error) {
+	capabilities := s.handler.CreateServerCapabilities()
 
 	// Set text document sync capabilities
 	capabilities.TextDocumentSync = protocol.TextDocumentSyncOptions{
 		OpenClose: &[]bool{true}[0],
-		Change:    &[]protocol.TextDocumentSyncKind{protocol.TextDocumentSyncKindFull}[0],
+		Change:    &[]protocol.TextDocumentSyncKind{protocol.TextDocumentSyncKindIncremental}[0],
 		Save: &protocol.SaveOptions{
 			IncludeText: &[]bool{true}[0],
 		},
@@ -70,11 +65,31 @@ func initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 	capabilities.HoverProvider = true
 
 	// Enable code actions
-	capabilities.CodeActionProvider = true
+	capabilities.CodeActionProvider = protocol.CodeActionOptions{
+		CodeActionKinds: []protocol.CodeActionKind{
+			protocol.CodeActionKindQuickFix,
+			protocol.CodeActionKindRefactorExtract,
+			codeActionKindFixAll,
+		},
+	}
+
+	// Complete keys and tables in gitleaks configs
+	capabilities.CompletionProvider = &protocol.CompletionOptions{
+		TriggerCharacters: []string{"["},
+	}
+
+	// Each workspace folder has its own config and ignore file
+	if capabilities.Workspace == nil {
+		capabilities.Workspace = &protocol.ServerCapabilitiesWorkspace{}
+	}
+	capabilities.Workspace.WorkspaceFolders = &protocol.WorkspaceFoldersServerCapabilities{
+		Supported:           &[]bool{true}[0],
+		ChangeNotifications: &protocol.BoolOrString{Value: true},
+	}
 
 	// Enable execute command
 	capabilities.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
-		Commands: []string{"gitleaks.scanWorkspace"},
+		Commands: []string{"gitleaks.scanWorkspace", "gitleaks.scanHistory", "gitleaks.scanStaged", "gitleaks.exportReport", "gitleaks.serverInfo"},
 	}
 
 	clientName := "unknown"
@@ -90,42 +105,95 @@ func initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 		"clientName", clientName,
 		"clientVersion", clientVersion)
 
-	rootPath := ""
-	if params.RootPath != nil {
-		rootPath = *params.RootPath
-	} else if params.RootURI != nil {
-		rootPath = uriToPath(*params.RootURI)
+	// Settings are applied first so that the scanner sees baselinePath
+	if s.settings.ApplyInitializationOptions(params.InitializationOptions) {
+		slog.Info("applied settings from initializationOptions")
 	}
 
-	if err := SetupServer(rootPath); err != nil {
+	if err := s.setup(workspaceFolders(params)); err != nil {
 		slog.Error("failed to setup server", "error", err)
 		return nil, err
 	}
 
+	s.setClient(context)
+	if params.Trace != nil {
+		s.setTraceValue(*params.Trace)
+	}
+
+	if ws := params.Capabilities.Workspace; ws != nil && ws.Configuration != nil {
+		s.supportsConfiguration = *ws.Configuration
+	}
+
+	serverInfo := &protocol.InitializeResultServerInfo{
+		Name:    lsName,
+		Version: &version,
+	}
+
+	// Advertise pull diagnostics only to clients that support them;
+	// everyone else keeps receiving publishDiagnostics
+	s.pullDiagnostics, s.diagnosticRefresh = parsePullCapabilities(context.Params)
+	if s.pullDiagnostics {
+		slog.Info("client supports pull diagnostics")
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				ServerCapabilities: capabilities,
+				DiagnosticProvider: &DiagnosticOptions{
+					InterFileDependencies: false,
+					WorkspaceDiagnostics:  true,
+				},
+			},
+			ServerInfo: serverInfo,
+		}, nil
+	}
+
 	return protocol.InitializeResult{
 		Capabilities: capabilities,
-		ServerInfo: &protocol.InitializeResultServerInfo{
-			Name:    lsName,
-			Version: &version,
-		},
+		ServerInfo:   serverInfo,
 	}, nil
 }
 
-func initialized(context *glsp.Context, params *protocol.InitializedParams) error {
+func (s *Server) initialized(context *glsp.Context, params *protocol.InitializedParams) error {
 	slog.Info("client confirmed initialization")
+
+	s.publishConfigDiagnostics(context)
+	s.logConfigSources(context)
+
+	// Pull settings asynchronously; the client answers on the same connection
+	if s.supportsConfiguration {
+		go s.fetchConfiguration(context)
+	}
+
 	return nil
 }
 
-func shutdown(context *glsp.Context) error {
+func (s *Server) shutdown(context *glsp.Context) error {
 	slog.Info("shutting down")
-	if globalServer != nil && globalServer.cancel != nil {
-		globalServer.cancel()
-	}
-	protocol.SetTraceValue(protocol.TraceValueOff)
+	s.Close()
+	s.setTraceValue(protocol.TraceValueOff)
 	return nil
 }
 
-func setTrace(context *glsp.Context, params *protocol.SetTraceParams) error {
-	protocol.SetTraceValue(params.Value)
+func (s *Server) setTrace(context *glsp.Context, params *protocol.SetTraceParams) error {
+	s.setTraceValue(params.Value)
 	return nil
 }
+
+// setTraceValue records the trace level of this server's client. Unlike
+// protocol.SetTraceValue it leaves the other connections of --listen alone.
+func (s *Server) setTraceValue(value protocol.TraceValue) {
+	// The spec says "message", but some clients send "messages"
+	if value == "messages" {
+		value = protocol.TraceValueMessage
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trace = value
+}
+
+// getTraceValue returns the trace level of this server's client (thread-safe)
+func (s *Server) getTraceValue() protocol.TraceValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trace
+}
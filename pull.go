@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// LSP 3.17 pull diagnostics. glsp only implements 3.16, so the request and
+// report types are declared here and dispatched by pullHandler.
+
+const (
+	MethodTextDocumentDiagnostic     = "textDocument/diagnostic"
+	MethodWorkspaceDiagnostic        = "workspace/diagnostic"
+	ServerWorkspaceDiagnosticRefresh = "workspace/diagnostic/refresh"
+
+	diagnosticReportFull      = "full"
+	diagnosticReportUnchanged = "unchanged"
+)
+
+// DiagnosticOptions is the server capability for pull diagnostics
+type DiagnosticOptions struct {
+	Identifier            *string `json:"identifier,omitempty"`
+	InterFileDependencies bool    `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool    `json:"workspaceDiagnostics"`
+}
+
+// DocumentDiagnosticParams are the parameters of textDocument/diagnostic
+type DocumentDiagnosticParams struct {
+	TextDocument     protocol.TextDocumentIdentifier `json:"textDocument"`
+	Identifier       *string                         `json:"identifier,omitempty"`
+	PreviousResultID *string                         `json:"previousResultId,omitempty"`
+}
+
+// FullDocumentDiagnosticReport carries a complete set of diagnostics
+type FullDocumentDiagnosticReport struct {
+	Kind     string                `json:"kind"`
+	ResultID *string               `json:"resultId,omitempty"`
+	Items    []protocol.Diagnostic `json:"items"`
+}
+
+// UnchangedDocumentDiagnosticReport tells the client its previous result is still valid
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     string `json:"kind"`
+	ResultID string `json:"resultId"`
+}
+
+// PreviousResultID pairs a document with the resultId the client holds for it
+type PreviousResultID struct {
+	URI   protocol.DocumentUri `json:"uri"`
+	Value string               `json:"value"`
+}
+
+// WorkspaceDiagnosticParams are the parameters of workspace/diagnostic
+type WorkspaceDiagnosticParams struct {
+	Identifier        *string            `json:"identifier,omitempty"`
+	PreviousResultIDs []PreviousResultID `json:"previousResultIds"`
+}
+
+// WorkspaceFullDocumentDiagnosticReport is a full report for one workspace document
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *int32               `json:"version"` // null for documents that are not open
+}
+
+// WorkspaceUnchangedDocumentDiagnosticReport is an unchanged report for one workspace document
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *int32               `json:"version"`
+}
+
+// WorkspaceDiagnosticReport is the result of workspace/diagnostic
+type WorkspaceDiagnosticReport struct {
+	Items []any `json:"items"` // WorkspaceFull- or WorkspaceUnchangedDocumentDiagnosticReport
+}
+
+// initializeResult extends the 3.16 result with the diagnosticProvider capability
+type initializeResult struct {
+	Capabilities serverCapabilities                   `json:"capabilities"`
+	ServerInfo   *protocol.InitializeResultServerInfo `json:"serverInfo,omitempty"`
+}
+
+type serverCapabilities struct {
+	protocol.ServerCapabilities
+	DiagnosticProvider *DiagnosticOptions `json:"diagnosticProvider,omitempty"`
+}
+
+// pullCapabilities holds the 3.17 client capabilities glsp does not decode
+type pullCapabilities struct {
+	Capabilities struct {
+		TextDocument *struct {
+			Diagnostic *struct{} `json:"diagnostic"`
+		} `json:"textDocument"`
+		Workspace *struct {
+			Diagnostics *struct {
+				RefreshSupport *bool `json:"refreshSupport"`
+			} `json:"diagnostics"`
+		} `json:"workspace"`
+	} `json:"capabilities"`
+}
+
+// parsePullCapabilities reports whether the client supports pull diagnostics
+// and workspace/diagnostic/refresh, from the raw initialize params
+func parsePullCapabilities(raw json.RawMessage) (pull bool, refresh bool) {
+	if len(raw) == 0 {
+		return false, false
+	}
+
+	var caps pullCapabilities
+	if err := json.Unmarshal(raw, &caps); err != nil {
+		return false, false
+	}
+
+	if td := caps.Capabilities.TextDocument; td != nil && td.Diagnostic != nil {
+		pull = true
+	}
+	if ws := caps.Capabilities.Workspace; ws != nil && ws.Diagnostics != nil && ws.Diagnostics.RefreshSupport != nil {
+		refresh = *ws.Diagnostics.RefreshSupport
+	}
+	return pull, refresh
+}
+
+// pullHandler dispatches the 3.17 diagnostic requests and delegates
+// everything else to the 3.16 protocol handler
+type pullHandler struct {
+	*protocol.Handler
+	server *Server
+}
+
+// glsp.Handler interface
+func (h pullHandler) Handle(context *glsp.Context) (r any, validMethod bool, validParams bool, err error) {
+	switch context.Method {
+	case MethodTextDocumentDiagnostic:
+		if !h.IsInitialized() {
+			return nil, true, true, errors.New("server not initialized")
+		}
+		var params DocumentDiagnosticParams
+		if err = json.Unmarshal(context.Params, &params); err == nil {
+			validParams = true
+			r, err = h.server.textDocumentDiagnostic(context, &params)
+		}
+		return r, true, validParams, err
+
+	case MethodWorkspaceDiagnostic:
+		if !h.IsInitialized() {
+			return nil, true, true, errors.New("server not initialized")
+		}
+		var params WorkspaceDiagnosticParams
+		if err = json.Unmarshal(context.Params, &params); err == nil {
+			validParams = true
+			r, err = h.server.workspaceDiagnostic(context, &params)
+		}
+		return r, true, validParams, err
+	}
+
+	return h.Handler.Handle(context)
+}
+
+// resultID derives a diagnostic resultId from the content hash. The
+// workspace folder and scanner of the document, its staged findings, the
+// folder's cache epoch and the settings generation are mixed in so that a
+// config reload, staged scan, settings change or folder change invalidates
+// results for unchanged content.
+func (s *Server) resultID(uri protocol.DocumentUri, content string) string {
+	folder := s.folderFor(uri)
+	scanner := folder.scannerFor(uriToPath(uri))
+	staged := strings.Join(s.stagedFindingIDs(uri), ",")
+	hash := sha256.Sum256([]byte(folder.rootPath() + "\x00" + staged + "\x00" + scanner.cacheKey(content)))
+	return fmt.Sprintf("%x-%d-%d", hash[:8], folder.cache.Epoch(), s.settings.Generation())
+}
+
+func (s *Server) textDocumentDiagnostic(context *glsp.Context, params *DocumentDiagnosticParams) (any, error) {
+	uri := params.TextDocument.URI
+
+	doc, ok := s.documents.Get(uri)
+	if !ok {
+		return FullDocumentDiagnosticReport{Kind: diagnosticReportFull, Items: []protocol.Diagnostic{}}, nil
+	}
+
+	resultID := s.resultID(uri, doc.Content)
+	if params.PreviousResultID != nil && *params.PreviousResultID == resultID {
+		return UnchangedDocumentDiagnosticReport{Kind: diagnosticReportUnchanged, ResultID: resultID}, nil
+	}
+
+	findings, _, err := s.scanDocument(s.ctx, uri, doc.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := s.documentDiagnostics(uri, doc.Content, findings)
+	s.documents.SetDiagnostics(uri, doc.Version, diagnostics, findings)
+
+	return FullDocumentDiagnosticReport{
+		Kind:     diagnosticReportFull,
+		ResultID: &resultID,
+		Items:    s.withStagedDiagnostics(uri, slices.Clip(diagnostics), findings),
+	}, nil
+}
+
+func (s *Server) workspaceDiagnostic(context *glsp.Context, params *WorkspaceDiagnosticParams) (any, error) {
+	previous := make(map[protocol.DocumentUri]string, len(params.PreviousResultIDs))
+	for _, p := range params.PreviousResultIDs {
+		previous[p.URI] = p.Value
+	}
+
+	report := WorkspaceDiagnosticReport{Items: []any{}}
+
+	// Open documents are served from the document store
+	open := make(map[protocol.DocumentUri]bool)
+	for _, doc := range s.documents.All() {
+		open[doc.URI] = true
+		version := doc.Version
+		item, err := s.workspaceDocumentReport(doc.URI, doc.Content, &version, previous[doc.URI])
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	// Unopened files are those reported by the last workspace or staged scan
+	reported := make(map[protocol.DocumentUri]bool)
+	for _, result := range []*WorkspaceScanResult{s.getWorkspaceResult(), s.getStagedResult()} {
+		if result == nil {
+			continue
+		}
+		for uri := range result.Findings {
+			if open[uri] || reported[uri] {
+				continue
+			}
+			reported[uri] = true
+
+			content, err := os.ReadFile(uriToPath(uri))
+			if err != nil {
+				// The file is gone; clear whatever the client still shows
+				report.Items = append(report.Items, WorkspaceFullDocumentDiagnosticReport{
+					FullDocumentDiagnosticReport: FullDocumentDiagnosticReport{
+						Kind:  diagnosticReportFull,
+						Items: []protocol.Diagnostic{},
+					},
+					URI: uri,
+				})
+				continue
+			}
+
+			item, err := s.workspaceDocumentReport(uri, string(content), nil, previous[uri])
+			if err != nil {
+				return nil, err
+			}
+			report.Items = append(report.Items, item)
+		}
+	}
+
+	// Files the client has results for that no scan reports any longer,
+	// such as those of an older staged scan, are cleared
+	for uri := range previous {
+		if !open[uri] && !reported[uri] {
+			report.Items = append(report.Items, WorkspaceFullDocumentDiagnosticReport{
+				FullDocumentDiagnosticReport: FullDocumentDiagnosticReport{
+					Kind:  diagnosticReportFull,
+					Items: []protocol.Diagnostic{},
+				},
+				URI: uri,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// workspaceDocumentReport builds a full or unchanged report for one document
+func (s *Server) workspaceDocumentReport(uri protocol.DocumentUri, content string, version *int32, previousResultID string) (any, error) {
+	resultID := s.resultID(uri, content)
+	if previousResultID == resultID {
+		return WorkspaceUnchangedDocumentDiagnosticReport{
+			UnchangedDocumentDiagnosticReport: UnchangedDocumentDiagnosticReport{
+				Kind:     diagnosticReportUnchanged,
+				ResultID: resultID,
+			},
+			URI:     uri,
+			Version: version,
+		}, nil
+	}
+
+	findings, _, err := s.scanDocument(s.ctx, uri, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return WorkspaceFullDocumentDiagnosticReport{
+		FullDocumentDiagnosticReport: FullDocumentDiagnosticReport{
+			Kind:     diagnosticReportFull,
+			ResultID: &resultID,
+			Items:    s.withStagedDiagnostics(uri, s.documentDiagnostics(uri, content, findings), findings),
+		},
+		URI:     uri,
+		Version: version,
+	}, nil
+}
+
+// requestDiagnosticRefresh asks a pull-model client to re-pull diagnostics.
+// The request is sent asynchronously so it is safe to call from a handler.
+func (s *Server) requestDiagnosticRefresh(glspContext *glsp.Context) {
+	if !s.diagnosticRefresh || glspContext.Call == nil {
+		return
+	}
+
+	go func() {
+		slog.Debug("requesting diagnostic refresh")
+		glspContext.Call(ServerWorkspaceDiagnosticRefresh, nil, nil)
+	}()
+}
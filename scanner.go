@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/zricethezav/gitleaks/v8/config"
@@ -28,6 +30,30 @@ type Finding struct {
 	Entropy     float32
 	File        string
 	Fingerprint string
+	ID          string // Stable identifier, embedded in diagnostic Data
+
+	// Set for findings from git history
+	Commit  string
+	Author  string
+	Email   string
+	Date    string
+	Message string
+	Link    string
+
+	// Set for findings kept in a cache while redaction is on: the secret
+	// is masked, so the baseline files listing it are kept instead
+	masked        bool
+	baselineFiles []string
+}
+
+// LogValue leaves the secret, match and line of a finding out of logs
+func (f Finding) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("rule", f.RuleID),
+		slog.String("file", f.File),
+		slog.Int("line", f.StartLine),
+		slog.String("fingerprint", f.Fingerprint),
+	)
 }
 
 // Scanner wraps gitleaks detection engine for LSP usage
@@ -36,6 +62,21 @@ type Scanner struct {
 	config         config.Config
 	ignoreFilePath string
 	ignoreSet      map[string]struct{} // Set of fingerprints to ignore
+	rootPath       string              // Workspace root, fingerprint paths are relative to it
+	baselinePath   string
+	baseline       map[baselineKey]string // Secret of each baseline finding by location
+	redact         uint                   // Percentage of secrets to mask, 0 for none
+}
+
+// baselineKey locates a finding of a baseline report, with the file
+// relative to the workspace root and 1-based lines as the CLI writes them
+type baselineKey struct {
+	file        string
+	ruleID      string
+	startLine   int
+	endLine     int
+	startColumn int
+	endColumn   int
 }
 
 // NewScanner creates a scanner with the provided config
@@ -53,8 +94,8 @@ func NewScanner(cfg config.Config) *Scanner {
 	}
 }
 
-// NewScannerWithIgnore creates a scanner with config and ignore file
-func NewScannerWithIgnore(cfg config.Config, ignoreFilePath string) *Scanner {
+// NewScannerWithIgnore creates a scanner for a workspace root with config and ignore file
+func NewScannerWithIgnore(cfg config.Config, rootPath, ignoreFilePath string) *Scanner {
 	detector := detect.NewDetector(cfg)
 	ignoreSet := make(map[string]struct{})
 
@@ -75,6 +116,7 @@ func NewScannerWithIgnore(cfg config.Config, ignoreFilePath string) *Scanner {
 	slog.Debug("scanner initialized",
 		"config", cfg.Path,
 		"rules", len(cfg.Rules),
+		"root", rootPath,
 		"ignorefile", ignoreFilePath)
 
 	return &Scanner{
@@ -82,9 +124,19 @@ func NewScannerWithIgnore(cfg config.Config, ignoreFilePath string) *Scanner {
 		config:         cfg,
 		ignoreFilePath: ignoreFilePath,
 		ignoreSet:      ignoreSet,
+		rootPath:       rootPath,
 	}
 }
 
+// cacheKey returns the key of content in a result cache shared by the
+// scanners of a workspace folder, which differ in config and ignore file.
+// The cache holds the findings of Detect, which only depend on the content
+// and the config, as returned by cacheFindings; the file's ignore and
+// baseline entries are applied by Filter on every lookup.
+func (s *Scanner) cacheKey(content string) string {
+	return s.config.Path + "\x00" + s.ignoreFilePath + "\x00" + content
+}
+
 // loadGitleaksIgnore loads fingerprints from a .gitleaksignore file
 func loadGitleaksIgnore(path string) (map[string]struct{}, error) {
 	ignoreSet := make(map[string]struct{})
@@ -125,9 +177,92 @@ func loadGitleaksIgnore(path string) (map[string]struct{}, error) {
 	return ignoreSet, scanner.Err()
 }
 
+// LoadBaseline loads a gitleaks JSON report whose findings are suppressed
+// by ScanContent. It must be called before the scanner is shared.
+func (s *Scanner) LoadBaseline(path string) error {
+	s.baselinePath = path
+
+	findings, err := detect.LoadBaseline(path)
+	if err != nil {
+		return err
+	}
+
+	s.baseline = make(map[baselineKey]string, len(findings))
+	for _, f := range findings {
+		key := baselineKey{
+			file:        filepath.ToSlash(f.File),
+			ruleID:      f.RuleID,
+			startLine:   f.StartLine,
+			endLine:     f.EndLine,
+			startColumn: f.StartColumn,
+			endColumn:   f.EndColumn,
+		}
+		s.baseline[key] = f.Secret
+	}
+
+	slog.Info("loaded baseline", "path", path, "findings", len(findings))
+	return nil
+}
+
+// SetRedact masks percent of the secret of every finding, as the CLI's
+// --redact does, so that the findings never hold the secret itself. It
+// must be called before the scanner is shared.
+func (s *Scanner) SetRedact(percent uint) {
+	s.redact = percent
+}
+
+// inBaseline reports whether a finding is already listed in the baseline.
+// Like the CLI's --baseline-path, the location must match exactly; commit
+// metadata is not compared since the editor scans the working tree.
+func (s *Scanner) inBaseline(f Finding) bool {
+	if len(s.baseline) == 0 {
+		return false
+	}
+
+	key := baselineKey{
+		file:        fingerprintPath(s.rootPath, f.File),
+		ruleID:      f.RuleID,
+		startLine:   f.StartLine + 1,
+		endLine:     f.EndLine + 1,
+		startColumn: f.StartColumn,
+		endColumn:   f.EndColumn,
+	}
+	secret, ok := s.baseline[key]
+	if f.masked {
+		return ok && slices.Contains(f.baselineFiles, key.file)
+	}
+	return ok && baselineSecretMatches(secret, f.Secret)
+}
+
+// baselineSecretMatches compares a secret with one from a baseline, which
+// may have been written with --redact: fully ("REDACTED") or as a prefix
+// followed by "..."
+func baselineSecretMatches(baseline, secret string) bool {
+	switch {
+	case baseline == secret, baseline == "REDACTED":
+		return true
+	case strings.HasSuffix(baseline, "..."):
+		return strings.HasPrefix(secret, strings.TrimSuffix(baseline, "..."))
+	default:
+		return false
+	}
+}
+
 // ScanContent scans the provided content and returns findings
-// Returns empty slice for files that are too large or have errors
-func (s *Scanner) ScanContent(_ context.Context, filename, content string) ([]Finding, error) {
+// Returns empty slice for files that are too large or have errors.
+// Returns ctx.Err() if the scan was cancelled before it completed.
+func (s *Scanner) ScanContent(ctx context.Context, filename, content string) ([]Finding, error) {
+	findings, err := s.Detect(ctx, filename, content)
+	if err != nil {
+		return nil, err
+	}
+	return s.Filter(findings), nil
+}
+
+// Detect returns the findings in content before the ignore file, the
+// baseline and redaction are applied, which depend on the file, so that
+// they can be cached by content. The secrets are not masked; see Filter.
+func (s *Scanner) Detect(ctx context.Context, filename, content string) ([]Finding, error) {
 	const maxSize = 1_000_000 // 1MB limit
 
 	if len(content) > maxSize {
@@ -144,32 +279,93 @@ func (s *Scanner) ScanContent(_ context.Context, filename, content string) ([]Fi
 	}
 
 	// Detect secrets using gitleaks Detect method
-	gitleaksFindings := s.detector.Detect(fragment)
+	gitleaksFindings := s.detector.DetectContext(ctx, fragment)
+
+	// A cancelled detection returns partial results, which must not be used
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	// Convert gitleaks findings to our Finding type, filtering ignored ones
 	findings := make([]Finding, 0, len(gitleaksFindings))
 	for _, gf := range gitleaksFindings {
+		findings = append(findings, convertGitleaksFinding(gf, calculateFingerprint(gf, s.rootPath)))
+	}
+	return findings, nil
+}
+
+// Filter drops the findings listed in the ignore file or the baseline and
+// masks the secrets of the others if redaction is on. The findings must be
+// bound to the file they are reported for, see rebindFindings.
+func (s *Scanner) Filter(findings []Finding) []Finding {
+	// The baseline report lists the secrets it suppresses
+	if len(findings) > 0 && s.baselinePath != "" && findings[0].File == s.baselinePath {
+		return nil
+	}
+
+	filtered := make([]Finding, 0, len(findings))
+	for _, f := range findings {
 		// Check if this finding should be ignored
-		globalFingerprint := fmt.Sprintf("%s:%s:%d", gf.File, gf.RuleID, gf.StartLine)
-		if _, ignored := s.ignoreSet[globalFingerprint]; ignored {
+		if _, ignored := s.ignoreSet[f.Fingerprint]; ignored {
 			slog.Debug("ignoring finding",
-				"fingerprint", globalFingerprint,
-				"rule", gf.RuleID)
+				"fingerprint", f.Fingerprint,
+				"rule", f.RuleID)
+			continue
+		}
+
+		if s.inBaseline(f) {
+			slog.Debug("skipping baseline finding",
+				"fingerprint", f.Fingerprint,
+				"rule", f.RuleID)
 			continue
 		}
 
-		findings = append(findings, convertGitleaksFinding(gf))
+		// The baseline is compared with the secret before it is masked
+		if s.redact > 0 && !f.masked {
+			f = redactFinding(f, s.redact)
+		}
+		f.masked, f.baselineFiles = false, nil
+		filtered = append(filtered, f)
 	}
+	return filtered
+}
 
-	return findings, nil
+// cacheFindings returns the findings of Detect as they may be kept in a
+// cache. With redaction on the secrets are masked, and the files of the
+// baseline entries each secret matches are recorded for Filter instead.
+// The cache is cleared when the baseline or redaction changes.
+func (s *Scanner) cacheFindings(findings []Finding) []Finding {
+	if s.redact == 0 {
+		return findings
+	}
+
+	cached := make([]Finding, len(findings))
+	for i, f := range findings {
+		var files []string
+		for key, secret := range s.baseline {
+			if key.ruleID == f.RuleID && key.startLine == f.StartLine+1 && key.endLine == f.EndLine+1 &&
+				key.startColumn == f.StartColumn && key.endColumn == f.EndColumn && baselineSecretMatches(secret, f.Secret) {
+				files = append(files, key.file)
+			}
+		}
+		f = redactFinding(f, s.redact)
+		f.masked, f.baselineFiles = true, files
+		cached[i] = f
+	}
+	return cached
 }
 
-// convertGitleaksFinding converts gitleaks report.Finding to our Finding type
-func convertGitleaksFinding(gf report.Finding) Finding {
-	// Calculate fingerprint for this finding
-	fingerprint := calculateFingerprint(gf)
+// redactFinding masks the secret of f in its secret, match and line, as
+// the CLI's --redact does
+func redactFinding(f Finding, percent uint) Finding {
+	gf := report.Finding{Secret: f.Secret, Match: f.Match, Line: f.Line}
+	gf.Redact(percent)
+	f.Secret, f.Match, f.Line = gf.Secret, gf.Match, gf.Line
+	return f
+}
 
-	return Finding{
+// convertGitleaksFinding converts gitleaks report.Finding to our Finding type
+func convertGitleaksFinding(gf report.Finding, fingerprint string) Finding {
+	f := Finding{
 		RuleID:      gf.RuleID,
 		Description: gf.Description,
 		Match:       gf.Match,
@@ -182,13 +378,70 @@ func convertGitleaksFinding(gf report.Finding) Finding {
 		Entropy:     gf.Entropy,
 		File:        gf.File,
 		Fingerprint: fingerprint,
+		Commit:      gf.Commit,
+		Author:      gf.Author,
+		Email:       gf.Email,
+		Date:        gf.Date,
+		Message:     gf.Message,
+		Link:        gf.Link,
+	}
+	f.ID = calculateFindingID(f)
+	return f
+}
+
+// calculateFingerprint returns the gitleaks fingerprint of a finding,
+// file:rule-id:start-line, as the CLI reports it and .gitleaksignore lists
+// it: the file relative to rootPath and the line 1-based. Files outside
+// rootPath keep the path they were scanned under.
+func calculateFingerprint(gf report.Finding, rootPath string) string {
+	return fmt.Sprintf("%s:%s:%d", fingerprintPath(rootPath, gf.File), gf.RuleID, gf.StartLine+1)
+}
+
+// fingerprintPath returns file as it appears in fingerprints and reports:
+// relative to rootPath when inside it, otherwise unchanged
+func fingerprintPath(rootPath, file string) string {
+	if rel, ok := relativePath(rootPath, file); ok {
+		return rel
+	}
+	return filepath.ToSlash(file)
+}
+
+// relativePath returns file relative to rootPath with forward slashes.
+// ok is false if there is no root or file lies outside it.
+func relativePath(rootPath, file string) (string, bool) {
+	if rootPath == "" {
+		return "", false
 	}
+	rel, err := filepath.Rel(rootPath, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
 }
 
-// calculateFingerprint creates a unique identifier for a finding
-func calculateFingerprint(gf report.Finding) string {
-	// Use file, line, and rule to create fingerprint
-	data := fmt.Sprintf("%s:%d:%s", gf.File, gf.StartLine, gf.RuleID)
+// calculateFindingID creates a stable identifier for a finding from its
+// file, rule and exact location. Unlike the fingerprint it distinguishes
+// several findings of the same rule on one line.
+func calculateFindingID(f Finding) string {
+	data := fmt.Sprintf("%s:%s:%d:%d:%d:%d", f.File, f.RuleID, f.StartLine, f.StartColumn, f.EndLine, f.EndColumn)
 	hash := sha256.Sum256([]byte(data))
-	return fmt.Sprintf("%x", hash[:8]) // First 8 bytes as hex
+	return fmt.Sprintf("%x", hash[:8])
+}
+
+// rebindFindings returns findings for filename. Cached findings are keyed
+// by content only, so a cache hit may carry the file, fingerprint and ID of
+// another file with identical content.
+func rebindFindings(findings []Finding, rootPath, filename string) []Finding {
+	if len(findings) == 0 || findings[0].File == filename {
+		return findings
+	}
+
+	rebound := make([]Finding, len(findings))
+	for i, f := range findings {
+		f.File = filename
+		f.Fingerprint = calculateFingerprint(report.Finding{File: filename, StartLine: f.StartLine, RuleID: f.RuleID}, rootPath)
+		f.ID = calculateFindingID(f)
+		rebound[i] = f
+	}
+	return rebound
 }
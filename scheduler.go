@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// ScanScheduler debounces scans per document. Scheduling a new scan for a
+// URI stops the pending timer and cancels the context of any scan that is
+// already running for it.
+type ScanScheduler struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	pending map[protocol.DocumentUri]*pendingScan
+}
+
+// pendingScan tracks a scheduled or running scan
+type pendingScan struct {
+	timer  *time.Timer // nil for scans run without delay
+	cancel context.CancelFunc
+}
+
+// NewScanScheduler creates a scheduler whose scans are cancelled when ctx is
+func NewScanScheduler(ctx context.Context) *ScanScheduler {
+	return &ScanScheduler{
+		ctx:     ctx,
+		pending: make(map[protocol.DocumentUri]*pendingScan),
+	}
+}
+
+// Schedule runs scan for uri after delay, superseding any earlier scan for
+// the same URI. A delay of zero runs the scan synchronously.
+func (s *ScanScheduler) Schedule(uri protocol.DocumentUri, delay time.Duration, scan func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	p := &pendingScan{cancel: cancel}
+
+	s.mu.Lock()
+	s.stopLocked(uri)
+	s.pending[uri] = p
+	if delay > 0 {
+		p.timer = time.AfterFunc(delay, func() {
+			scan(ctx)
+			s.finish(uri, p)
+		})
+	}
+	s.mu.Unlock()
+
+	if delay <= 0 {
+		scan(ctx)
+		s.finish(uri, p)
+	}
+}
+
+// Cancel stops any pending or running scan for uri
+func (s *ScanScheduler) Cancel(uri protocol.DocumentUri) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked(uri)
+}
+
+// Pending returns the number of scans that are scheduled or running
+func (s *ScanScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// stopLocked stops and forgets the scan for uri; s.mu must be held
+func (s *ScanScheduler) stopLocked(uri protocol.DocumentUri) {
+	if p, ok := s.pending[uri]; ok {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.cancel()
+		delete(s.pending, uri)
+	}
+}
+
+// finish releases a completed scan unless it has already been superseded
+func (s *ScanScheduler) finish(uri protocol.DocumentUri, p *pendingScan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[uri] == p {
+		delete(s.pending, uri)
+	}
+	p.cancel()
+}
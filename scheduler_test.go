@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanScheduler_ZeroDelayRunsSynchronously(t *testing.T) {
+	s := NewScanScheduler(context.Background())
+
+	ran := false
+	s.Schedule("file:///a.go", 0, func(ctx context.Context) {
+		ran = true
+		assert.NoError(t, ctx.Err())
+	})
+
+	assert.True(t, ran)
+	assert.Equal(t, 0, s.Pending())
+}
+
+func TestScanScheduler_Debounces(t *testing.T) {
+	s := NewScanScheduler(context.Background())
+
+	var runs atomic.Int32
+	var last atomic.Int32
+	for i := 1; i <= 5; i++ {
+		n := int32(i)
+		s.Schedule("file:///a.go", 20*time.Millisecond, func(ctx context.Context) {
+			runs.Add(1)
+			last.Store(n)
+		})
+	}
+
+	require.Eventually(t, func() bool { return s.Pending() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load(), "only the last scan should run")
+	assert.Equal(t, int32(5), last.Load())
+}
+
+func TestScanScheduler_CancelsRunningScan(t *testing.T) {
+	s := NewScanScheduler(context.Background())
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s.Schedule("file:///a.go", time.Millisecond, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	<-started
+	s.Schedule("file:///a.go", time.Hour, func(ctx context.Context) {})
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("superseded scan was not cancelled")
+	}
+
+	s.Cancel("file:///a.go")
+	assert.Equal(t, 0, s.Pending())
+}
+
+func TestScanScheduler_Cancel(t *testing.T) {
+	s := NewScanScheduler(context.Background())
+
+	var runs atomic.Int32
+	s.Schedule("file:///a.go", 10*time.Millisecond, func(ctx context.Context) {
+		runs.Add(1)
+	})
+	s.Cancel("file:///a.go")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(0), runs.Load())
+	assert.Equal(t, 0, s.Pending())
+}
+
+func TestScanScheduler_IndependentURIs(t *testing.T) {
+	s := NewScanScheduler(context.Background())
+
+	var runs atomic.Int32
+	for _, uri := range []string{"file:///a.go", "file:///b.go"} {
+		s.Schedule(uri, 10*time.Millisecond, func(ctx context.Context) {
+			runs.Add(1)
+		})
+	}
+
+	require.Eventually(t, func() bool { return runs.Load() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestScanScheduler_ParentCancellation(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	s := NewScanScheduler(parent)
+	cancel()
+
+	var err error
+	s.Schedule("file:///a.go", 0, func(ctx context.Context) {
+		err = ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
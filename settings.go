@@ -2,6 +2,7 @@ package main
 
 import (
 	"sync"
+	"time"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
@@ -12,26 +13,66 @@ type Settings struct {
 	// Valid values: "error", "warning", "information", "hint"
 	// Default: "warning"
 	DiagnosticSeverity string `json:"diagnosticSeverity"`
+
+	// DebounceMs is how long to wait after the last edit before scanning
+	// a changed document. 0 scans on every change.
+	// Default: 300
+	DebounceMs int `json:"debounceMs"`
+
+	// BaselinePath is a gitleaks JSON report, relative to the workspace
+	// root, whose findings are not reported. Empty uses
+	// gitleaks-baseline.json or .gitleaks-baseline.json in the root.
+	// Default: ""
+	BaselinePath string `json:"baselinePath"`
+
+	// ConfigPath is a gitleaks config, relative to the workspace root,
+	// used instead of GITLEAKS_CONFIG, GITLEAKS_CONFIG_TOML and the
+	// .gitleaks.toml files of the workspace.
+	// Default: ""
+	ConfigPath string `json:"configPath"`
+
+	// Redact masks this percentage of every secret, like the gitleaks
+	// CLI's --redact, in diagnostics, hover, reports and logs. Findings
+	// are then kept without the secret itself. true is 100.
+	// Default: 0 (off)
+	Redact uint `json:"redact"`
 }
 
 // DefaultSettings returns the default configuration
 func DefaultSettings() *Settings {
 	return &Settings{
 		DiagnosticSeverity: "warning",
+		DebounceMs:         300,
 	}
 }
 
-// Global settings instance
-var (
-	settingsMu     sync.RWMutex
-	serverSettings = DefaultSettings()
-)
+// ServerSettings holds the settings of one server instance. It is safe for
+// concurrent use.
+type ServerSettings struct {
+	mu       sync.RWMutex
+	settings Settings
+
+	// generation is incremented whenever a setting changes
+	generation uint64
+}
+
+// NewServerSettings returns server settings initialized to the defaults
+func NewServerSettings() *ServerSettings {
+	return &ServerSettings{settings: *DefaultSettings()}
+}
 
-// GetDiagnosticSeverity returns the LSP severity based on settings
-func GetDiagnosticSeverity() protocol.DiagnosticSeverity {
-	settingsMu.RLock()
-	severity := serverSettings.DiagnosticSeverity
-	settingsMu.RUnlock()
+// Generation returns a counter that changes with every settings update
+func (s *ServerSettings) Generation() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
+}
+
+// DiagnosticSeverity returns the LSP severity based on settings
+func (s *ServerSettings) DiagnosticSeverity() protocol.DiagnosticSeverity {
+	s.mu.RLock()
+	severity := s.settings.DiagnosticSeverity
+	s.mu.RUnlock()
 
 	switch severity {
 	case "error":
@@ -47,18 +88,127 @@ func GetDiagnosticSeverity() protocol.DiagnosticSeverity {
 	}
 }
 
-// UpdateSettings updates server settings from client configuration
-func UpdateSettings(config map[string]interface{}) {
+// DebounceDelay returns how long to wait before scanning a changed document
+func (s *ServerSettings) DebounceDelay() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.settings.DebounceMs <= 0 {
+		return 0
+	}
+	return time.Duration(s.settings.DebounceMs) * time.Millisecond
+}
+
+// BaselinePath returns the configured baseline report path
+func (s *ServerSettings) BaselinePath() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings.BaselinePath
+}
+
+// ConfigPath returns the configured gitleaks config path
+func (s *ServerSettings) ConfigPath() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings.ConfigPath
+}
+
+// Redact returns the percentage of secrets to mask, 0 for none
+func (s *ServerSettings) Redact() uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings.Redact
+}
+
+// Update updates server settings from client configuration.
+// The config is expected in the didChangeConfiguration shape, with the
+// server's options nested under a "gitleaks" key. Returns true if any
+// setting changed.
+func (s *ServerSettings) Update(config map[string]interface{}) bool {
 	if config == nil {
-		return
+		return false
+	}
+
+	gitleaks, ok := config["gitleaks"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return s.UpdateSection(gitleaks)
+}
+
+// UpdateSection applies the contents of the "gitleaks" settings section,
+// as returned by workspace/configuration. Returns true if any setting
+// changed.
+func (s *ServerSettings) UpdateSection(section map[string]interface{}) bool {
+	if section == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	if severity, ok := section["diagnosticSeverity"].(string); ok {
+		if s.settings.DiagnosticSeverity != severity {
+			s.settings.DiagnosticSeverity = severity
+			changed = true
+		}
+	}
+
+	// JSON numbers decode as float64
+	if debounce, ok := section["debounceMs"].(float64); ok {
+		if s.settings.DebounceMs != int(debounce) {
+			s.settings.DebounceMs = int(debounce)
+			changed = true
+		}
 	}
 
-	settingsMu.Lock()
-	defer settingsMu.Unlock()
+	if baseline, ok := section["baselinePath"].(string); ok {
+		if s.settings.BaselinePath != baseline {
+			s.settings.BaselinePath = baseline
+			changed = true
+		}
+	}
 
-	if gitleaks, ok := config["gitleaks"].(map[string]interface{}); ok {
-		if severity, ok := gitleaks["diagnosticSeverity"].(string); ok {
-			serverSettings.DiagnosticSeverity = severity
+	if configPath, ok := section["configPath"].(string); ok {
+		if s.settings.ConfigPath != configPath {
+			s.settings.ConfigPath = configPath
+			changed = true
 		}
 	}
+
+	// A percentage, or true for full redaction like a bare --redact
+	var redact any = section["redact"]
+	if on, ok := redact.(bool); ok {
+		redact = 0.0
+		if on {
+			redact = 100.0
+		}
+	}
+	if percent, ok := redact.(float64); ok {
+		percent = min(max(percent, 0), 100)
+		if s.settings.Redact != uint(percent) {
+			s.settings.Redact = uint(percent)
+			changed = true
+		}
+	}
+
+	if changed {
+		s.generation++
+	}
+	return changed
+}
+
+// ApplyInitializationOptions applies settings passed in
+// InitializeParams.InitializationOptions. Both the nested
+// {"gitleaks": {...}} shape and a bare settings section are accepted.
+func (s *ServerSettings) ApplyInitializationOptions(options any) bool {
+	opts, ok := options.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, nested := opts["gitleaks"]; nested {
+		return s.Update(opts)
+	}
+	return s.UpdateSection(opts)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -12,7 +13,7 @@ func TestDefaultSettings(t *testing.T) {
 	assert.Equal(t, "warning", settings.DiagnosticSeverity)
 }
 
-func TestGetDiagnosticSeverity(t *testing.T) {
+func TestDiagnosticSeverity(t *testing.T) {
 	tests := []struct {
 		setting  string
 		expected protocol.DiagnosticSeverity
@@ -27,19 +28,17 @@ func TestGetDiagnosticSeverity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.setting, func(t *testing.T) {
-			serverSettings.DiagnosticSeverity = tt.setting
-			result := GetDiagnosticSeverity()
-			assert.Equal(t, tt.expected, result)
+			t.Parallel()
+			settings := NewServerSettings()
+			settings.UpdateSection(map[string]interface{}{"diagnosticSeverity": tt.setting})
+			assert.Equal(t, tt.expected, settings.DiagnosticSeverity())
 		})
 	}
-
-	// Reset to default
-	serverSettings = DefaultSettings()
 }
 
 func TestUpdateSettings(t *testing.T) {
-	// Reset before test
-	serverSettings = DefaultSettings()
+	t.Parallel()
+	settings := NewServerSettings()
 
 	// Test updating with valid config
 	config := map[string]interface{}{
@@ -47,17 +46,104 @@ func TestUpdateSettings(t *testing.T) {
 			"diagnosticSeverity": "error",
 		},
 	}
-	UpdateSettings(config)
-	assert.Equal(t, "error", serverSettings.DiagnosticSeverity)
+	settings.Update(config)
+	assert.Equal(t, protocol.DiagnosticSeverityError, settings.DiagnosticSeverity())
 
 	// Test with nil config
-	UpdateSettings(nil)
-	assert.Equal(t, "error", serverSettings.DiagnosticSeverity) // unchanged
+	settings.Update(nil)
+	assert.Equal(t, protocol.DiagnosticSeverityError, settings.DiagnosticSeverity()) // unchanged
 
 	// Test with missing gitleaks key
-	UpdateSettings(map[string]interface{}{"other": "value"})
-	assert.Equal(t, "error", serverSettings.DiagnosticSeverity) // unchanged
+	settings.Update(map[string]interface{}{"other": "value"})
+	assert.Equal(t, protocol.DiagnosticSeverityError, settings.DiagnosticSeverity()) // unchanged
+}
+
+func TestUpdateSettings_ReportsChange(t *testing.T) {
+	t.Parallel()
+	settings := NewServerSettings()
+
+	config := map[string]interface{}{
+		"gitleaks": map[string]interface{}{
+			"diagnosticSeverity": "error",
+		},
+	}
+	generation := settings.Generation()
+	assert.True(t, settings.Update(config), "first update should report a change")
+	assert.False(t, settings.Update(config), "identical update should not report a change")
+	assert.Equal(t, generation+1, settings.Generation())
+}
+
+func TestUpdateSettings_Independent(t *testing.T) {
+	t.Parallel()
+	a, b := NewServerSettings(), NewServerSettings()
+
+	a.UpdateSection(map[string]interface{}{"diagnosticSeverity": "error"})
+	assert.Equal(t, protocol.DiagnosticSeverityError, a.DiagnosticSeverity())
+	assert.Equal(t, protocol.DiagnosticSeverityWarning, b.DiagnosticSeverity(), "settings are per server")
+}
+
+func TestApplyInitializationOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  any
+		changed  bool
+		expected protocol.DiagnosticSeverity
+	}{
+		{"nil", nil, false, protocol.DiagnosticSeverityWarning},
+		{"not a map", "error", false, protocol.DiagnosticSeverityWarning},
+		{"nested", map[string]interface{}{
+			"gitleaks": map[string]interface{}{"diagnosticSeverity": "hint"},
+		}, true, protocol.DiagnosticSeverityHint},
+		{"bare section", map[string]interface{}{"diagnosticSeverity": "error"}, true, protocol.DiagnosticSeverityError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			settings := NewServerSettings()
+			assert.Equal(t, tt.changed, settings.ApplyInitializationOptions(tt.options))
+			assert.Equal(t, tt.expected, settings.DiagnosticSeverity())
+		})
+	}
+}
+
+func TestBaselinePathSetting(t *testing.T) {
+	t.Parallel()
+	settings := NewServerSettings()
+
+	assert.Empty(t, settings.BaselinePath())
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"baselinePath": "gitleaks-report.json"}))
+	assert.Equal(t, "gitleaks-report.json", settings.BaselinePath())
+	assert.False(t, settings.UpdateSection(map[string]interface{}{"baselinePath": "gitleaks-report.json"}))
+}
+
+func TestDebounceDelay(t *testing.T) {
+	t.Parallel()
+	settings := NewServerSettings()
+	assert.Equal(t, 300*time.Millisecond, settings.DebounceDelay())
+
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"debounceMs": float64(50)}))
+	assert.Equal(t, 50*time.Millisecond, settings.DebounceDelay())
+
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"debounceMs": float64(-1)}))
+	assert.Equal(t, time.Duration(0), settings.DebounceDelay())
+}
+
+func TestRedactSetting(t *testing.T) {
+	t.Parallel()
+	settings := NewServerSettings()
+	assert.Equal(t, uint(0), settings.Redact())
+
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"redact": float64(20)}))
+	assert.Equal(t, uint(20), settings.Redact())
+	assert.False(t, settings.UpdateSection(map[string]interface{}{"redact": float64(20)}))
+
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"redact": true}))
+	assert.Equal(t, uint(100), settings.Redact())
+
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"redact": float64(-5)}))
+	assert.Equal(t, uint(0), settings.Redact())
 
-	// Reset
-	serverSettings = DefaultSettings()
+	assert.True(t, settings.UpdateSection(map[string]interface{}{"redact": float64(250)}))
+	assert.Equal(t, uint(100), settings.Redact())
 }
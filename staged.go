@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/zricethezav/gitleaks/v8/cmd/scm"
+	"github.com/zricethezav/gitleaks/v8/sources"
+)
+
+// ScanStaged scans the changes staged for commit in the repository at
+// rootPath, like `gitleaks protect --staged`. Findings are keyed by file URI
+// and located in the staged version of each file.
+func (s *Server) ScanStaged(ctx context.Context, rootPath string) (*WorkspaceScanResult, error) {
+	if rootPath == "" {
+		return nil, nil
+	}
+
+	repoPath, err := gitTopLevel(ctx, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	detector := s.folderFor(pathToURI(rootPath)).newGitDetector(ctx, repoPath)
+
+	cmd, err := sources.NewGitDiffCmdContext(ctx, repoPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("running git diff: %w", err)
+	}
+
+	source := &fragmentCounter{
+		Source: &sources.Git{
+			Cmd:    cmd,
+			Config: &detector.Config,
+			Remote: sources.NewRemoteInfoContext(ctx, scm.UnknownPlatform, repoPath),
+			Sema:   detector.Sema,
+		},
+		key: func(fragment sources.Fragment) string { return fragment.FilePath },
+	}
+
+	gitleaksFindings, err := detector.DetectSource(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("scanning staged changes: %w", err)
+	}
+
+	result := &WorkspaceScanResult{
+		TotalFiles:    source.Seen(),
+		ScannedFiles:  source.Seen(),
+		TotalFindings: len(gitleaksFindings),
+		Findings:      make(map[string][]Finding),
+	}
+	for _, gf := range gitleaksFindings {
+		f := convertGitFinding(repoPath, gf)
+		uri := pathToURI(f.File)
+		result.Findings[uri] = append(result.Findings[uri], f)
+	}
+
+	slog.Info("staged scan complete",
+		"files", result.ScannedFiles,
+		"findings", result.TotalFindings)
+
+	return result, nil
+}
+
+// publishStagedFindings records the findings of a staged scan and
+// publishes them with the diagnostics of open documents, clearing those of
+// files that had staged findings in the previous scan. Pull-model clients
+// are asked to pull diagnostics again instead, which include them.
+func (s *Server) publishStagedFindings(ctx *glsp.Context, result *WorkspaceScanResult) {
+	s.mu.Lock()
+	previous := s.stagedResult
+	s.stagedResult = result
+	s.mu.Unlock()
+
+	if s.pullDiagnostics {
+		s.requestDiagnosticRefresh(ctx)
+		return
+	}
+
+	uris := slices.Collect(maps.Keys(result.Findings))
+	if previous != nil {
+		for uri := range previous.Findings {
+			if _, ok := result.Findings[uri]; !ok {
+				uris = append(uris, uri)
+			}
+		}
+	}
+
+	for _, uri := range uris {
+		diagnostics := []protocol.Diagnostic{}
+		var findings []Finding
+		if doc, ok := s.documents.Get(uri); ok {
+			diagnostics = append(diagnostics, doc.Diagnostics...)
+			findings = doc.Findings
+		}
+		ctx.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: s.withStagedDiagnostics(uri, diagnostics, findings),
+		})
+	}
+}
+
+// withStagedDiagnostics appends the diagnostics of the findings of the last
+// staged scan in the file at uri to its diagnostics. Staged findings that
+// are also among findings, which the diagnostics report, are left out.
+func (s *Server) withStagedDiagnostics(uri protocol.DocumentUri, diagnostics []protocol.Diagnostic, findings []Finding) []protocol.Diagnostic {
+	result := s.getStagedResult()
+	if result == nil {
+		return diagnostics
+	}
+	staged := slices.DeleteFunc(slices.Clone(result.Findings[uri]), func(f Finding) bool {
+		return slices.ContainsFunc(findings, func(own Finding) bool { return own.ID == f.ID })
+	})
+	return append(diagnostics, s.diagnostics(staged)...)
+}
+
+// stagedFindingIDs returns the IDs of the findings of the last staged scan
+// in the file at uri
+func (s *Server) stagedFindingIDs(uri protocol.DocumentUri) []string {
+	var ids []string
+	if result := s.getStagedResult(); result != nil {
+		for _, f := range result.Findings[uri] {
+			ids = append(ids, f.ID)
+		}
+	}
+	return ids
+}
+
+// handleScanStagedCommand handles the scanStaged command
+func (s *Server) handleScanStagedCommand(ctx *glsp.Context, _ *protocol.ExecuteCommandParams) (any, error) {
+	progress := NewProgressReporter(ctx, "Scanning staged changes for secrets")
+
+	folders, err := s.repositoryFolders(s.ctx)
+	if err != nil {
+		progress.End("Scan failed")
+		slog.Error("staged scan failed", "error", err)
+		return nil, err
+	}
+	if len(folders) == 0 {
+		progress.End("No workspace to scan")
+		return nil, nil
+	}
+
+	result := &WorkspaceScanResult{Findings: make(map[string][]Finding)}
+	for _, folder := range folders {
+		folderResult, err := s.ScanStaged(s.ctx, folder.rootPath())
+		if err != nil {
+			progress.End("Scan failed")
+			slog.Error("staged scan failed", "folder", folder.Name, "error", err)
+			return nil, err
+		}
+		result.merge(folderResult)
+	}
+
+	passed := result.TotalFindings == 0
+	if passed {
+		progress.End(fmt.Sprintf("No secrets in %d staged files", result.ScannedFiles))
+	} else {
+		progress.End(fmt.Sprintf("Found %d secrets in %d staged files", result.TotalFindings, len(result.Findings)))
+	}
+
+	s.publishStagedFindings(ctx, result)
+
+	return map[string]any{
+		"passed":            passed,
+		"stagedFiles":       result.ScannedFiles,
+		"totalFindings":     result.TotalFindings,
+		"filesWithFindings": len(result.Findings),
+	}, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/sourcegraph/jsonrpc2"
+	wsjsonrpc2 "github.com/sourcegraph/jsonrpc2/websocket"
+	"github.com/tliron/glsp"
+	"github.com/tliron/glsp/server"
+)
+
+// errInvalidListenAddress is returned for --listen values that name no transport
+var errInvalidListenAddress = errors.New("invalid listen address")
+
+// listenAddress is a parsed --listen flag
+type listenAddress struct {
+	transport string // "tcp", "unix" or "ws"
+	address   string
+}
+
+// parseListenAddress parses tcp:host:port, unix:/path or ws:host:port
+func parseListenAddress(value string) (listenAddress, error) {
+	transport, address, ok := strings.Cut(value, ":")
+	if !ok || address == "" {
+		return listenAddress{}, fmt.Errorf("%w: %q", errInvalidListenAddress, value)
+	}
+	switch transport {
+	case "tcp", "unix", "ws":
+		return listenAddress{transport: transport, address: address}, nil
+	default:
+		return listenAddress{}, fmt.Errorf("%w: unknown transport %q", errInvalidListenAddress, transport)
+	}
+}
+
+// serve runs the language server until ctx is done: over stdio if listen is
+// empty, otherwise on the given address with a Server per connection
+func serve(ctx context.Context, listen string) error {
+	if listen == "" {
+		s := NewServer()
+		defer s.Close()
+		return server.NewServer(s.Handler(), lsName, false).RunStdio()
+	}
+
+	addr, err := parseListenAddress(listen)
+	if err != nil {
+		return err
+	}
+
+	if addr.transport == "unix" {
+		removeStaleSocket(addr.address)
+	}
+	network := addr.transport
+	if network == "ws" {
+		network = "tcp"
+	}
+	listener, err := net.Listen(network, addr.address)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("listening for connections", "transport", addr.transport, "address", listener.Addr())
+	if addr.transport == "ws" {
+		return serveWebSocket(ctx, listener)
+	}
+	return serveListener(ctx, listener)
+}
+
+// removeStaleSocket removes a socket file left behind by a server that did
+// not shut down cleanly; other files are left for net.Listen to fail on
+func removeStaleSocket(path string) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			slog.Warn("failed to remove stale socket", "path", path, "error", err)
+		}
+	}
+}
+
+// serveListener accepts stream connections until ctx is done, then closes
+// the remaining connections and waits for their servers to shut down
+func serveListener(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(ctx, jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{}), conn.RemoteAddr().String())
+		}()
+	}
+}
+
+// serveWebSocket serves LSP over WebSocket connections until ctx is done
+func serveWebSocket(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			socket, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				slog.Warn("failed to upgrade to WebSocket", "remote", r.RemoteAddr, "error", err)
+				return
+			}
+
+			wg.Add(1)
+			defer wg.Done()
+			serveConn(ctx, wsjsonrpc2.NewObjectStream(socket), r.RemoteAddr)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveConn serves one client connection with its own Server. The server
+// is closed when the client disconnects or ctx is done.
+func serveConn(ctx context.Context, stream jsonrpc2.ObjectStream, remote string) {
+	slog.Info("client connected", "remote", remote)
+
+	s := NewServer()
+	defer s.Close()
+
+	conn := jsonrpc2.NewConn(ctx, stream, jsonrpcHandler(s.Handler()))
+	select {
+	case <-conn.DisconnectNotify():
+	case <-ctx.Done():
+		conn.Close()
+	}
+
+	slog.Info("client disconnected", "remote", remote)
+}
+
+// jsonrpcHandler adapts a glsp handler to a jsonrpc2 connection. It copies
+// the unexported handle method of glsp's server, since glsp's RunTCP and
+// RunWebSocket share one handler, and so one Server, across connections;
+// compare it with server/handle.go when upgrading glsp.
+func jsonrpcHandler(handler glsp.Handler) jsonrpc2.Handler {
+	return jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) (any, error) {
+		glspContext := glsp.Context{
+			Method: request.Method,
+			Notify: func(method string, params any) {
+				if err := conn.Notify(ctx, method, params); err != nil {
+					slog.Debug("failed to notify client", "method", method, "error", err)
+				}
+			},
+			Call: func(method string, params any, result any) {
+				if err := conn.Call(ctx, method, params, result); err != nil {
+					slog.Debug("failed to call client", "method", method, "error", err)
+				}
+			},
+		}
+		if request.Params != nil {
+			glspContext.Params = *request.Params
+		}
+
+		if request.Method == "exit" {
+			handler.Handle(&glspContext)
+			return nil, conn.Close()
+		}
+
+		result, validMethod, validParams, err := handler.Handle(&glspContext)
+		switch {
+		case !validMethod:
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: fmt.Sprintf("method not supported: %s", request.Method)}
+		case !validParams:
+			rpcErr := &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+			if err != nil {
+				rpcErr.Message = err.Error()
+			}
+			return nil, rpcErr
+		case err != nil:
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: err.Error()}
+		}
+		return result, nil
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -71,7 +72,22 @@ type WorkspaceScanResult struct {
 	Findings      map[string][]Finding // URI -> findings
 }
 
-// ScanWorkspace scans all files in the workspace
+// merge adds the files and findings of other to r
+func (r *WorkspaceScanResult) merge(other *WorkspaceScanResult) {
+	if other == nil {
+		return
+	}
+	r.TotalFiles += other.TotalFiles
+	r.ScannedFiles += other.ScannedFiles
+	r.SkippedFiles += other.SkippedFiles
+	r.TotalFindings += other.TotalFindings
+	for uri, findings := range other.Findings {
+		r.Findings[uri] = append(r.Findings[uri], findings...)
+	}
+}
+
+// ScanWorkspace scans all files under rootPath, each with the scanner of
+// the workspace folder that contains it
 func (s *Server) ScanWorkspace(ctx context.Context, rootPath string, progress *ProgressReporter) (*WorkspaceScanResult, error) {
 	if rootPath == "" {
 		return nil, nil
@@ -82,6 +98,15 @@ func (s *Server) ScanWorkspace(ctx context.Context, rootPath string, progress *P
 	if err != nil {
 		return nil, fmt.Errorf("collecting files: %w", err)
 	}
+	files = slices.DeleteFunc(files, s.isReport)
+
+	// Configs and ignore files may have been added in directories that
+	// are not watched since the last scan
+	for _, f := range s.getFolders() {
+		if _, ok := relativePath(rootPath, f.rootPath()); ok {
+			f.forgetResolved()
+		}
+	}
 
 	slog.Info("starting workspace scan",
 		"rootPath", rootPath,
@@ -103,6 +128,7 @@ func (s *Server) ScanWorkspace(ctx context.Context, rootPath string, progress *P
 	for i, file := range files {
 		select {
 		case <-ctx.Done():
+			wg.Wait()
 			return result, ctx.Err()
 		default:
 		}
@@ -140,6 +166,11 @@ func (s *Server) ScanWorkspace(ctx context.Context, rootPath string, progress *P
 
 	wg.Wait()
 
+	// Files whose scan was cancelled count as skipped; the result is partial
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
 	result.ScannedFiles = int(scanned)
 	result.SkippedFiles = int(skipped)
 
@@ -168,7 +199,10 @@ func (s *Server) scanFile(ctx context.Context, filePath string) ([]Finding, erro
 		return nil, nil
 	}
 
-	return s.scanner.ScanContent(ctx, filePath, string(content))
+	// Nested workspace folders and projects scan their files with their
+	// own config
+	scanner := s.folderFor(pathToURI(filePath)).scannerFor(filePath)
+	return scanner.ScanContent(ctx, filePath, string(content))
 }
 
 // collectFiles walks the directory tree and collects scannable files
@@ -278,7 +312,7 @@ func isBinaryContent(content []byte) bool {
 // PublishWorkspaceFindings publishes diagnostics for all findings from a workspace scan
 func (s *Server) PublishWorkspaceFindings(ctx *glsp.Context, result *WorkspaceScanResult) {
 	for uri, findings := range result.Findings {
-		diagnostics := FindingsToDiagnostics(findings)
+		diagnostics := s.diagnostics(findings)
 		ctx.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
 			URI:         uri,
 			Diagnostics: diagnostics,
@@ -287,51 +321,135 @@ func (s *Server) PublishWorkspaceFindings(ctx *glsp.Context, result *WorkspaceSc
 }
 
 // ExecuteCommand handles workspace/executeCommand requests
-func executeCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+func (s *Server) executeCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	// Commands need the workspace set up by initialize
+	if len(s.getFolders()) == 0 {
+		return nil, nil
+	}
+
 	switch params.Command {
 	case "gitleaks.scanWorkspace":
-		return handleScanWorkspaceCommand(ctx, params)
+		return s.handleScanWorkspaceCommand(ctx, params)
+	case "gitleaks.scanHistory":
+		return s.handleScanHistoryCommand(ctx, params)
+	case "gitleaks.scanStaged":
+		return s.handleScanStagedCommand(ctx, params)
+	case "gitleaks.exportReport":
+		return s.handleExportReportCommand(ctx, params)
+	case "gitleaks.serverInfo":
+		return s.handleServerInfoCommand(), nil
 	default:
 		slog.Warn("unknown command", "command", params.Command)
 		return nil, nil
 	}
 }
 
-// handleScanWorkspaceCommand handles the scanWorkspace command
-func handleScanWorkspaceCommand(ctx *glsp.Context, _ *protocol.ExecuteCommandParams) (any, error) {
-	if globalServer == nil {
-		return nil, nil
+// handleServerInfoCommand reports the server version and, for every
+// workspace folder, the config of its root and where it came from
+func (s *Server) handleServerInfoCommand() map[string]any {
+	folders := make([]map[string]any, 0, len(s.getFolders()))
+	for _, f := range s.getFolders() {
+		folders = append(folders, map[string]any{
+			"name":         f.Name,
+			"root":         f.rootPath(),
+			"config":       f.config.Path(),
+			"configSource": f.config.Source(),
+		})
 	}
 
-	// Get workspace root from config or use current directory
-	rootPath := ""
-	if globalServer.config != nil {
-		rootPath = globalServer.config.rootPath
+	return map[string]any{
+		"name":    lsName,
+		"version": version,
+		"folders": folders,
+	}
+}
+
+// logConfigSources logs with window/logMessage which config each workspace
+// folder uses and where it came from, at startup and whenever it changes
+func (s *Server) logConfigSources(glspContext *glsp.Context) {
+	for _, f := range s.getFolders() {
+		config := f.config.Path()
+		if config == "" {
+			config = "no config file"
+		}
+		name := f.Name
+		if name == "" {
+			name = "workspace"
+		}
+		message := fmt.Sprintf("gitleaks: %s uses %s (source: %s)", name, config, f.config.Source())
+
+		f.mu.Lock()
+		logged := f.loggedSource == message
+		f.loggedSource = message
+		f.mu.Unlock()
+		if logged {
+			continue
+		}
+
+		glspContext.Notify(protocol.ServerWindowLogMessage, protocol.LogMessageParams{
+			Type:    protocol.MessageTypeInfo,
+			Message: message,
+		})
+	}
+}
+
+// handleScanWorkspaceCommand handles the scanWorkspace command. An optional
+// ExportOptions argument also writes the results to a report file.
+func (s *Server) handleScanWorkspaceCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	var export *ExportOptions
+	if len(params.Arguments) > 0 {
+		opts, err := parseExportOptions(params.Arguments[0])
+		if err != nil {
+			return nil, err
+		}
+		export = &opts
 	}
 
 	// Create progress reporter
 	progress := NewProgressReporter(ctx, "Scanning workspace for secrets")
 
-	bgCtx := context.Background()
-	result, err := globalServer.ScanWorkspace(bgCtx, rootPath, progress)
-	if err != nil {
-		progress.End("Scan failed")
-		slog.Error("workspace scan failed", "error", err)
-		return nil, err
+	// Scan every workspace folder; nested folders are covered by their
+	// parent. Shutdown or a closed connection cancels the scan.
+	result := &WorkspaceScanResult{Findings: make(map[string][]Finding)}
+	for _, folder := range s.rootFolders() {
+		folderResult, err := s.ScanWorkspace(s.ctx, folder.rootPath(), progress)
+		if err != nil {
+			progress.End("Scan failed")
+			slog.Error("workspace scan failed", "folder", folder.Name, "error", err)
+			return nil, err
+		}
+		result.merge(folderResult)
 	}
 
 	// End progress with summary
 	progress.End(fmt.Sprintf("Found %d secrets in %d files", result.TotalFindings, len(result.Findings)))
 
-	// Publish diagnostics for all findings
-	globalServer.PublishWorkspaceFindings(ctx, result)
+	s.setWorkspaceResult(result)
+
+	// Publish diagnostics for all findings, or let pull clients fetch them
+	if s.pullDiagnostics {
+		s.requestDiagnosticRefresh(ctx)
+	} else {
+		s.PublishWorkspaceFindings(ctx, result)
+	}
 
 	// Return summary
-	return map[string]any{
+	summary := map[string]any{
 		"totalFiles":        result.TotalFiles,
 		"scannedFiles":      result.ScannedFiles,
 		"skippedFiles":      result.SkippedFiles,
 		"totalFindings":     result.TotalFindings,
 		"filesWithFindings": len(result.Findings),
-	}, nil
+	}
+
+	if export != nil {
+		path, err := s.exportWorkspaceResult(result, *export)
+		if err != nil {
+			slog.Error("report export failed", "error", err)
+			return nil, err
+		}
+		summary["report"] = path
+	}
+
+	return summary, nil
 }
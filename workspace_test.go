@@ -125,8 +125,9 @@ func TestScanWorkspace(t *testing.T) {
 	ctx := context.Background()
 
 	// Initialize server
-	err := SetupServer("")
+	s, err := SetupServer("")
 	require.NoError(t, err)
+	defer s.Close()
 
 	// Create temp workspace with a secret
 	tmpDir := t.TempDir()
@@ -143,7 +144,7 @@ func main() {}
 	require.NoError(t, os.WriteFile(cleanFile, []byte(cleanContent), 0644))
 
 	// Scan workspace
-	result, err := globalServer.ScanWorkspace(ctx, tmpDir, nil)
+	result, err := s.ScanWorkspace(ctx, tmpDir, nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -165,10 +166,11 @@ func main() {}
 }
 
 func TestScanWorkspace_EmptyPath(t *testing.T) {
-	err := SetupServer("")
+	s, err := SetupServer("")
 	require.NoError(t, err)
+	defer s.Close()
 
-	result, err := globalServer.ScanWorkspace(context.Background(), "", nil)
+	result, err := s.ScanWorkspace(context.Background(), "", nil)
 	require.NoError(t, err)
 	assert.Nil(t, result)
 }